@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+// ErrCircuitOpen ユーザーサービスの障害が続いているため、問い合わせずに失敗させた。
+var ErrCircuitOpen = errors.New("user service circuit open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	// breakerHalfOpen 試しに1件だけ問い合わせている。
+	breakerHalfOpen
+)
+
+// CircuitBreakerUserDirectory 障害が続くユーザーサービスへの問い合わせを一定時間止めるUserDirectory
+// threshold回連続で失敗すると、cooldownの間は問い合わせずにErrCircuitOpenを返却する。
+// cooldown経過後は1件だけ問い合わせ、成功すれば元に戻す。
+type CircuitBreakerUserDirectory struct {
+	next      UserDirectory
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+
+	stats *expvar.Map
+}
+
+// NewCircuitBreakerUserDirectory nextへの問い合わせをサーキットブレーカーで保護するUserDirectoryを生成する。
+func NewCircuitBreakerUserDirectory(next UserDirectory, threshold int, cooldown time.Duration) *CircuitBreakerUserDirectory {
+	d := &CircuitBreakerUserDirectory{
+		next:      next,
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		stats:     new(expvar.Map).Init(),
+	}
+	for _, key := range []string{"opens", "rejected"} {
+		d.stats.Add(key, 0)
+	}
+	return d
+}
+
+// Stats 遮断した回数(opens)と、遮断中に失敗させた問い合わせ数(rejected)
+func (d *CircuitBreakerUserDirectory) Stats() *expvar.Map {
+	return d.stats
+}
+
+// FindByIDs 遮断中はErrCircuitOpenを返却する。
+func (d *CircuitBreakerUserDirectory) FindByIDs(ctx context.Context, ids []int) (map[int]entity.User, error) {
+	if err := d.allow(); err != nil {
+		return nil, err
+	}
+
+	users, err := d.next.FindByIDs(ctx, ids)
+	d.record(err)
+	return users, err
+}
+
+// Authenticate 遮断中はErrCircuitOpenを返却する。無効なトークンは障害として扱わない。
+func (d *CircuitBreakerUserDirectory) Authenticate(ctx context.Context, token string) (int, error) {
+	if err := d.allow(); err != nil {
+		return 0, err
+	}
+
+	userID, err := d.next.Authenticate(ctx, token)
+	d.record(err)
+	return userID, err
+}
+
+func (d *CircuitBreakerUserDirectory) allow() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch d.state {
+	case breakerOpen:
+		if d.now().Sub(d.openedAt) < d.cooldown {
+			d.stats.Add("rejected", 1)
+			return ErrCircuitOpen
+		}
+		d.state = breakerHalfOpen
+		return nil
+	case breakerHalfOpen:
+		d.stats.Add("rejected", 1)
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+func (d *CircuitBreakerUserDirectory) record(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !isUpstreamFailure(err) {
+		d.state = breakerClosed
+		d.failures = 0
+		return
+	}
+
+	d.failures++
+	if d.state == breakerHalfOpen || d.failures >= d.threshold {
+		if d.state != breakerOpen {
+			d.stats.Add("opens", 1)
+		}
+		d.state = breakerOpen
+		d.openedAt = d.now()
+	}
+}
+
+// isUpstreamFailure ユーザーサービス側の障害によるエラーの場合にtrueを返却する。
+// 無効なトークンなどリクエスト内容によるエラーや、呼び出し元が中断した場合は含めない。
+func isUpstreamFailure(err error) bool {
+	if err == nil || err == ErrInvalidToken || IsRejected(err) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreakerUserDirectory(t *testing.T) {
+	next := newCountingUserDirectory()
+	next.Tokens = map[string]int{"testToken": 1}
+	breaker := NewCircuitBreakerUserDirectory(next, 2, time.Minute)
+	clock := &testClock{now: time.Now()}
+	breaker.now = clock.Now
+
+	// 無効なトークンは障害として数えない。
+	for i := 0; i < 3; i++ {
+		_, err := breaker.Authenticate(context.Background(), "invalid")
+		assert.Equal(t, ErrInvalidToken, err)
+	}
+
+	next.Err = errors.New("unavailable")
+	breaker.FindByIDs(context.Background(), []int{1})
+	breaker.FindByIDs(context.Background(), []int{1})
+	assert.Equal(t, 2, len(next.requested))
+
+	// 遮断中は問い合わせない。
+	_, err := breaker.FindByIDs(context.Background(), []int{1})
+	assert.Equal(t, ErrCircuitOpen, err)
+	assert.Equal(t, 2, len(next.requested))
+	assert.Equal(t, "1", breaker.Stats().Get("opens").String())
+
+	// cooldown経過後に試した1件が失敗した場合は再度遮断する。
+	clock.now = clock.now.Add(2 * time.Minute)
+	breaker.FindByIDs(context.Background(), []int{1})
+	_, err = breaker.FindByIDs(context.Background(), []int{1})
+	assert.Equal(t, ErrCircuitOpen, err)
+	assert.Equal(t, 3, len(next.requested))
+
+	// 試した1件が成功した場合は元に戻す。
+	next.Err = nil
+	clock.now = clock.now.Add(2 * time.Minute)
+	_, err = breaker.FindByIDs(context.Background(), []int{1})
+	assert.Equal(t, nil, err)
+	_, err = breaker.FindByIDs(context.Background(), []int{1})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 5, len(next.requested))
+}
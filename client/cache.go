@@ -0,0 +1,275 @@
+package client
+
+import (
+	"container/list"
+	"context"
+	"expvar"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+// CacheConfig ユーザー情報キャッシュの設定
+type CacheConfig struct {
+	// TTL 取得したユーザー情報をそのまま使用する期間
+	TTL time.Duration
+	// StaleTTL TTL経過後、裏で再取得しつつ古いユーザー情報を返却する期間
+	StaleTTL time.Duration
+	// NegativeTTL 存在しなかったユーザーIDを再問い合わせしない期間
+	NegativeTTL time.Duration
+	// MaxEntries 保持するユーザー数の上限。超えた場合は最も使われていないものから破棄する。
+	MaxEntries int
+}
+
+// DefaultCacheConfig ユーザー情報キャッシュの既定の設定
+var DefaultCacheConfig = CacheConfig{
+	TTL:         time.Minute,
+	StaleTTL:    10 * time.Minute,
+	NegativeTTL: 30 * time.Second,
+	MaxEntries:  10000,
+}
+
+// LoadCacheConfig 環境変数からユーザー情報キャッシュの設定を読み込む。未設定の項目は既定値とする。
+// USER_CACHE_TTL, USER_CACHE_STALE_TTL, USER_CACHE_NEGATIVE_TTL は"30s"などの形式で指定する。
+func LoadCacheConfig() (CacheConfig, error) {
+	config := DefaultCacheConfig
+	durations := map[string]*time.Duration{
+		"USER_CACHE_TTL":          &config.TTL,
+		"USER_CACHE_STALE_TTL":    &config.StaleTTL,
+		"USER_CACHE_NEGATIVE_TTL": &config.NegativeTTL,
+	}
+	for key, d := range durations {
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return CacheConfig{}, err
+		}
+		*d = parsed
+	}
+
+	if value := os.Getenv("USER_CACHE_SIZE"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return CacheConfig{}, err
+		}
+		config.MaxEntries = size
+	}
+
+	return config, nil
+}
+
+type cacheEntry struct {
+	id        int
+	user      entity.User
+	found     bool
+	fetchedAt time.Time
+	// refreshing 裏で再取得中
+	refreshing bool
+	element    *list.Element
+}
+
+// CachingUserDirectory ユーザー情報をキャッシュするUserDirectory
+// トークンの認証はキャッシュせずにそのまま問い合わせる。
+type CachingUserDirectory struct {
+	next   UserDirectory
+	config CacheConfig
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[int]*cacheEntry
+	// lru 先頭ほど最近使用したエントリ
+	lru *list.List
+
+	stats     *expvar.Map
+	refreshWG sync.WaitGroup
+}
+
+// NewCachingUserDirectory nextへの問い合わせ結果をキャッシュするUserDirectoryを生成する。
+func NewCachingUserDirectory(next UserDirectory, config CacheConfig) *CachingUserDirectory {
+	d := &CachingUserDirectory{
+		next:    next,
+		config:  config,
+		now:     time.Now,
+		entries: map[int]*cacheEntry{},
+		lru:     list.New(),
+		stats:   new(expvar.Map).Init(),
+	}
+	for _, key := range []string{"hits", "negative_hits", "stale_hits", "misses", "refreshes", "refresh_errors", "evictions"} {
+		d.stats.Add(key, 0)
+	}
+	return d
+}
+
+// Stats ヒット・ミス・再取得などの件数
+// hits, negative_hits, stale_hits, misses, refreshes, refresh_errors, evictions を保持する。
+func (d *CachingUserDirectory) Stats() *expvar.Map {
+	return d.stats
+}
+
+// Authenticate キャッシュせずに問い合わせる。
+func (d *CachingUserDirectory) Authenticate(ctx context.Context, token string) (int, error) {
+	return d.next.Authenticate(ctx, token)
+}
+
+// FindByIDs キャッシュに無い・期限切れのユーザーのみ問い合わせる。
+// 期限切れでもStaleTTL内であれば古いユーザー情報を返却し、裏で再取得する。
+// 問い合わせに失敗した場合は、期限切れのユーザー情報が残っていればそれを返却する。
+// 残っていないユーザーがいる場合は、取得できたユーザー情報とエラーの両方を返却する。
+func (d *CachingUserDirectory) FindByIDs(ctx context.Context, ids []int) (map[int]entity.User, error) {
+	users := map[int]entity.User{}
+	var missing, stale []int
+
+	d.mu.Lock()
+	now := d.now()
+	for _, id := range ids {
+		entry, ok := d.entries[id]
+		if !ok {
+			d.stats.Add("misses", 1)
+			missing = append(missing, id)
+			continue
+		}
+		d.lru.MoveToFront(entry.element)
+
+		age := now.Sub(entry.fetchedAt)
+		switch {
+		case !entry.found && age < d.config.NegativeTTL:
+			d.stats.Add("negative_hits", 1)
+		case entry.found && age < d.config.TTL:
+			d.stats.Add("hits", 1)
+			users[id] = entry.user
+		case entry.found && age < d.config.TTL+d.config.StaleTTL:
+			d.stats.Add("stale_hits", 1)
+			users[id] = entry.user
+			if !entry.refreshing {
+				entry.refreshing = true
+				stale = append(stale, id)
+			}
+		default:
+			d.stats.Add("misses", 1)
+			missing = append(missing, id)
+		}
+	}
+	d.mu.Unlock()
+
+	if len(stale) > 0 {
+		d.refreshWG.Add(1)
+		go d.refresh(stale)
+	}
+
+	if len(missing) == 0 {
+		return users, nil
+	}
+
+	found, err := d.next.FindByIDs(ctx, missing)
+	for id, user := range found {
+		users[id] = user
+	}
+	if err != nil {
+		// 失敗時も取得できたユーザー情報は保持し、残りのみ期限切れのユーザー情報で補う。
+		d.store(foundIDs(found), found)
+		return d.fallback(users, notFound(missing, found), err)
+	}
+
+	d.store(missing, found)
+	return users, nil
+}
+
+// foundIDs 取得できたユーザーのIDを返却する。
+func foundIDs(found map[int]entity.User) []int {
+	ids := make([]int, 0, len(found))
+	for id := range found {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// notFound idsのうちfoundに無いIDを返却する。
+func notFound(ids []int, found map[int]entity.User) []int {
+	var rest []int
+	for _, id := range ids {
+		if _, ok := found[id]; !ok {
+			rest = append(rest, id)
+		}
+	}
+	return rest
+}
+
+// refresh 期限切れのユーザー情報を裏で再取得する。
+func (d *CachingUserDirectory) refresh(ids []int) {
+	defer d.refreshWG.Done()
+
+	found, err := d.next.FindByIDs(context.Background(), ids)
+	if err != nil {
+		d.stats.Add("refresh_errors", 1)
+		d.store(foundIDs(found), found)
+		d.mu.Lock()
+		for _, id := range notFound(ids, found) {
+			if entry, ok := d.entries[id]; ok {
+				entry.refreshing = false
+			}
+		}
+		d.mu.Unlock()
+		return
+	}
+
+	d.stats.Add("refreshes", 1)
+	d.store(ids, found)
+}
+
+// fallback 問い合わせに失敗したユーザーについて、期限切れのユーザー情報が残っていればそれを使用する。
+// 残っていないユーザーがいる場合は、usersとともにerrを返却する。
+func (d *CachingUserDirectory) fallback(users map[int]entity.User, missing []int, err error) (map[int]entity.User, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var unresolved bool
+	for _, id := range missing {
+		entry, ok := d.entries[id]
+		if !ok {
+			unresolved = true
+			continue
+		}
+		if entry.found {
+			users[id] = entry.user
+		}
+	}
+	if unresolved {
+		return users, err
+	}
+	return users, nil
+}
+
+// store 問い合わせ結果を保持する。idsのうちfoundに無いものは存在しないユーザーとして保持する。
+func (d *CachingUserDirectory) store(ids []int, found map[int]entity.User) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	for _, id := range ids {
+		user, ok := found[id]
+		entry, exists := d.entries[id]
+		if !exists {
+			entry = &cacheEntry{id: id}
+			entry.element = d.lru.PushFront(entry)
+			d.entries[id] = entry
+		} else {
+			d.lru.MoveToFront(entry.element)
+		}
+		entry.user = user
+		entry.found = ok
+		entry.fetchedAt = now
+		entry.refreshing = false
+	}
+
+	for d.config.MaxEntries > 0 && d.lru.Len() > d.config.MaxEntries {
+		oldest := d.lru.Remove(d.lru.Back()).(*cacheEntry)
+		delete(d.entries, oldest.id)
+		d.stats.Add("evictions", 1)
+	}
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingUserDirectory 問い合わせられたユーザーIDを記録するUserDirectory
+type countingUserDirectory struct {
+	FakeUserDirectory
+	mu        sync.Mutex
+	requested [][]int
+}
+
+func (d *countingUserDirectory) FindByIDs(ctx context.Context, ids []int) (map[int]entity.User, error) {
+	d.mu.Lock()
+	d.requested = append(d.requested, ids)
+	d.mu.Unlock()
+	return d.FakeUserDirectory.FindByIDs(ctx, ids)
+}
+
+func newCountingUserDirectory() *countingUserDirectory {
+	return &countingUserDirectory{FakeUserDirectory: FakeUserDirectory{
+		Users: map[int]entity.User{1: {ID: 1, Name: "taro"}, 2: {ID: 2, Name: "yamada"}},
+	}}
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time { return c.now }
+
+func newTestCache(next UserDirectory, config CacheConfig) (*CachingUserDirectory, *testClock) {
+	clock := &testClock{now: time.Now()}
+	cache := NewCachingUserDirectory(next, config)
+	cache.now = clock.Now
+	return cache, clock
+}
+
+func TestCachingUserDirectory(t *testing.T) {
+	next := newCountingUserDirectory()
+	cache, clock := newTestCache(next, CacheConfig{TTL: time.Minute, StaleTTL: time.Minute, NegativeTTL: time.Second})
+
+	users, err := cache.FindByIDs(context.Background(), []int{1, 3})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, map[int]entity.User{1: {ID: 1, Name: "taro"}}, users)
+
+	// ヒットしたユーザーと、存在しなかったユーザーは問い合わせない。
+	users, err = cache.FindByIDs(context.Background(), []int{1, 2, 3})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(users))
+	assert.Equal(t, [][]int{{1, 3}, {2}}, next.requested)
+	assert.Equal(t, "1", cache.Stats().Get("hits").String())
+	assert.Equal(t, "1", cache.Stats().Get("negative_hits").String())
+	assert.Equal(t, "3", cache.Stats().Get("misses").String())
+
+	// 存在しなかったユーザーはNegativeTTL経過後に再度問い合わせる。
+	clock.now = clock.now.Add(2 * time.Second)
+	cache.FindByIDs(context.Background(), []int{3})
+	assert.Equal(t, []int{3}, next.requested[2])
+}
+
+func TestCachingUserDirectoryStaleWhileRevalidate(t *testing.T) {
+	next := newCountingUserDirectory()
+	cache, clock := newTestCache(next, CacheConfig{TTL: time.Minute, StaleTTL: time.Minute})
+	cache.FindByIDs(context.Background(), []int{1})
+
+	// TTL経過後は古いユーザー情報を返却し、裏で再取得する。
+	next.Users[1] = entity.User{ID: 1, Name: "renamed"}
+	clock.now = clock.now.Add(90 * time.Second)
+	users, err := cache.FindByIDs(context.Background(), []int{1})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "taro", users[1].Name)
+	cache.refreshWG.Wait()
+	assert.Equal(t, "1", cache.Stats().Get("refreshes").String())
+
+	users, _ = cache.FindByIDs(context.Background(), []int{1})
+	assert.Equal(t, "renamed", users[1].Name)
+
+	// StaleTTLも経過した場合はユーザーサービスの障害時のみ古いユーザー情報を返却する。
+	clock.now = clock.now.Add(3 * time.Minute)
+	next.Err = errors.New("unavailable")
+	users, err = cache.FindByIDs(context.Background(), []int{1})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "renamed", users[1].Name)
+
+	// 古いユーザー情報も無いユーザーがいる場合は、取得できたユーザー情報とエラーを返却する。
+	users, err = cache.FindByIDs(context.Background(), []int{1, 2})
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, map[int]entity.User{1: {ID: 1, Name: "renamed"}}, users)
+}
+
+// partialUserDirectory 取得できたユーザー情報とエラーの両方を返却するUserDirectory
+type partialUserDirectory struct {
+	*countingUserDirectory
+}
+
+func (d *partialUserDirectory) FindByIDs(ctx context.Context, ids []int) (map[int]entity.User, error) {
+	users, _ := d.countingUserDirectory.FindByIDs(ctx, ids)
+	return users, errors.New("partially unavailable")
+}
+
+func TestCachingUserDirectoryPartialResult(t *testing.T) {
+	next := &partialUserDirectory{countingUserDirectory: newCountingUserDirectory()}
+	cache, _ := newTestCache(next, CacheConfig{TTL: time.Minute})
+
+	// 一部の問い合わせに失敗しても、取得できたユーザー情報は返却する。
+	users, err := cache.FindByIDs(context.Background(), []int{1, 3})
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, map[int]entity.User{1: {ID: 1, Name: "taro"}}, users)
+
+	// 取得できたユーザー情報は保持し、取得できなかったユーザーのみ問い合わせ直す。
+	users, err = cache.FindByIDs(context.Background(), []int{1, 3})
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, map[int]entity.User{1: {ID: 1, Name: "taro"}}, users)
+	assert.Equal(t, [][]int{{1, 3}, {3}}, next.requested)
+}
+
+func TestCachingUserDirectoryMaxEntries(t *testing.T) {
+	next := newCountingUserDirectory()
+	cache, _ := newTestCache(next, CacheConfig{TTL: time.Minute, MaxEntries: 2})
+
+	cache.FindByIDs(context.Background(), []int{1})
+	cache.FindByIDs(context.Background(), []int{2})
+	cache.FindByIDs(context.Background(), []int{1})
+	cache.FindByIDs(context.Background(), []int{3})
+
+	// 最も使われていないユーザー2が破棄される。
+	assert.Equal(t, 2, len(cache.entries))
+	_, ok := cache.entries[2]
+	assert.False(t, ok)
+	assert.Equal(t, "1", cache.Stats().Get("evictions").String())
+}
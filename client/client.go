@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+// ErrInvalidToken トークンがユーザーサービスで認証されなかった。
+var ErrInvalidToken = errors.New("token invalid")
+
+// UserDirectory ユーザーサービスへの問い合わせ
+type UserDirectory interface {
+	// FindByIDs 指定されたIDのユーザー情報を取得する。存在しないIDは結果に含まれない。
+	// 一部のユーザーのみ取得できた場合は、取得できたユーザー情報とエラーの両方を返却する。
+	FindByIDs(ctx context.Context, ids []int) (map[int]entity.User, error)
+	// Authenticate トークンを検証し、ユーザーIDを取得する。無効なトークンの場合はErrInvalidTokenを返却する。
+	Authenticate(ctx context.Context, token string) (int, error)
+}
+
+// PointLedger ポイントサービスへの問い合わせ
+type PointLedger interface {
+	// Total ユーザーの保有ポイントを取得する。
+	Total(ctx context.Context, userID int) (int, error)
+	// Create ポイントを登録する。同じ冪等キーで登録済みの場合は成功として扱う。
+	Create(ctx context.Context, entry PointEntry) error
+}
+
+// PointEntry ポイントサービスへ登録するポイント
+// ユーザーのトークンは有効期限があり再送時に使えないため、登録先はUserIDで指定する。
+type PointEntry struct {
+	UserID         int    `json:"userId"`
+	Number         int    `json:"number"`
+	Comment        string `json:"comment"`
+	IdempotencyKey string `json:"idempotencyKey"`
+}
+
+// StatusError 外部サービスが成功以外のステータスを返却した場合のエラー
+type StatusError struct {
+	URL    string
+	Status int
+}
+
+func (e *StatusError) Error() string {
+	return e.URL + ": status " + strconv.Itoa(e.Status)
+}
+
+// Temporary 外部サービス側の障害のため、再送すれば成功する可能性がある。
+func (e *StatusError) Temporary() bool {
+	return e.Status >= http.StatusInternalServerError || e.Status == http.StatusTooManyRequests
+}
+
+// IsRejected 外部サービスがリクエストを受け付けなかった（再送しても成功しない）場合にtrueを返却する。
+func IsRejected(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && !statusErr.Temporary()
+}
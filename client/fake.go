@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+// FakeUserDirectory メモリ上のユーザー情報を返却するUserDirectory。テスト用。
+type FakeUserDirectory struct {
+	// Users ユーザーIDとユーザー情報
+	Users map[int]entity.User
+	// Tokens トークンと認証されるユーザーID
+	Tokens map[string]int
+	// Err 設定されている場合は全ての問い合わせでこのエラーを返却する。
+	Err error
+}
+
+// FindByIDs Usersから指定されたIDのユーザー情報を返却する。
+func (d *FakeUserDirectory) FindByIDs(ctx context.Context, ids []int) (map[int]entity.User, error) {
+	if d.Err != nil {
+		return nil, d.Err
+	}
+
+	users := map[int]entity.User{}
+	for _, id := range ids {
+		if user, ok := d.Users[id]; ok {
+			users[id] = user
+		}
+	}
+	return users, nil
+}
+
+// Authenticate Tokensに登録されたトークンのみ認証する。
+func (d *FakeUserDirectory) Authenticate(ctx context.Context, token string) (int, error) {
+	if d.Err != nil {
+		return 0, d.Err
+	}
+
+	userID, ok := d.Tokens[token]
+	if !ok {
+		return 0, ErrInvalidToken
+	}
+	return userID, nil
+}
+
+// FakePointLedger 登録されたポイントをメモリ上に記録するPointLedger。テスト用。
+type FakePointLedger struct {
+	mu sync.Mutex
+	// Totals ユーザーIDと保有ポイント。未登録のユーザーはDefaultTotalとする。
+	Totals       map[int]int
+	DefaultTotal int
+	// Err 設定されている場合はCreateでこのエラーを返却する。
+	Err     error
+	entries []PointEntry
+}
+
+// Total Totalsに登録された保有ポイントを返却する。
+func (l *FakePointLedger) Total(ctx context.Context, userID int) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if total, ok := l.Totals[userID]; ok {
+		return total, nil
+	}
+	return l.DefaultTotal, nil
+}
+
+// Create ポイントを記録する。同じ冪等キーで記録済みの場合は何もしない。
+func (l *FakePointLedger) Create(ctx context.Context, entry PointEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.Err != nil {
+		return l.Err
+	}
+	for _, e := range l.entries {
+		if e.IdempotencyKey == entry.IdempotencyKey {
+			return nil
+		}
+	}
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+// Entries 記録されたポイントを取得する。
+func (l *FakePointLedger) Entries() []PointEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]PointEntry{}, l.entries...)
+}
@@ -0,0 +1,241 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+// DefaultTimeout 外部サービスへのリクエスト1回あたりのタイムアウト
+const DefaultTimeout = 5 * time.Second
+
+type httpClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+func newHTTPClient(baseURL string, timeout time.Duration) httpClient {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return httpClient{baseURL: baseURL, client: &http.Client{Timeout: timeout}}
+}
+
+// do リクエストを送信し、レスポンスのJSONをoutに格納する。
+// 2xx以外のステータスの場合は*StatusErrorを返却する。
+func (c httpClient) do(ctx context.Context, method string, path string, header http.Header, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		buf, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(buf)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for key := range header {
+		req.Header.Set(key, header.Get(key))
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		io.Copy(ioutil.Discard, resp.Body)
+		return &StatusError{URL: req.URL.Path, Status: resp.StatusCode}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && err != io.EOF {
+		return fmt.Errorf("%s %s: %w", method, req.URL.Path, err)
+	}
+	return nil
+}
+
+const (
+	// userLookupConcurrency 一括取得に対応していないユーザーサービスへ1件ずつ問い合わせる際の同時リクエスト数
+	userLookupConcurrency = 8
+	// batchRetryInterval 一括取得に対応していないと判断してから、再度一括取得を試すまでの期間
+	batchRetryInterval = 5 * time.Minute
+)
+
+type httpUserDirectory struct {
+	httpClient
+	now func() time.Time
+	// batchUnsupportedUntil この時刻(UnixNano)までは一括取得(GET /users?id=)を試さない。
+	// 一時的なエラーで一括取得を使えなくならないよう、batchRetryInterval後に再度試す。
+	batchUnsupportedUntil int64
+}
+
+// NewHTTPUserDirectory ユーザーサービス(baseURL)へHTTPで問い合わせるUserDirectoryを生成する。
+func NewHTTPUserDirectory(baseURL string, timeout time.Duration) UserDirectory {
+	return &httpUserDirectory{httpClient: newHTTPClient(baseURL, timeout), now: time.Now}
+}
+
+// FindByIDs GET /users?id=1&id=2 で一括取得する。
+// ユーザーサービスが一括取得に対応していない場合は、batchRetryIntervalの間GET /users/:idで1件ずつ取得する。
+func (d *httpUserDirectory) FindByIDs(ctx context.Context, ids []int) (map[int]entity.User, error) {
+	if len(ids) == 0 {
+		return map[int]entity.User{}, nil
+	}
+
+	if d.now().UnixNano() < atomic.LoadInt64(&d.batchUnsupportedUntil) {
+		return d.findEach(ctx, ids)
+	}
+
+	query := url.Values{}
+	wanted := map[int]bool{}
+	for _, id := range ids {
+		query.Add("id", strconv.Itoa(id))
+		wanted[id] = true
+	}
+
+	var response []entity.User
+	err := d.do(ctx, http.MethodGet, "/users?"+query.Encode(), nil, nil, &response)
+	if statusErr, ok := err.(*StatusError); ok &&
+		(statusErr.Status == http.StatusNotFound || statusErr.Status == http.StatusBadRequest) {
+		d.disableBatch()
+		return d.findEach(ctx, ids)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	users := map[int]entity.User{}
+	for _, user := range response {
+		if !wanted[user.ID] {
+			// 絞り込みが無視され全件が返却されている。
+			d.disableBatch()
+			continue
+		}
+		users[user.ID] = user
+	}
+	return users, nil
+}
+
+// disableBatch batchRetryIntervalの間、一括取得を試さない。
+func (d *httpUserDirectory) disableBatch() {
+	atomic.StoreInt64(&d.batchUnsupportedUntil, d.now().Add(batchRetryInterval).UnixNano())
+}
+
+// findEach GET /users/:idで1件ずつ取得する。存在しないユーザーは結果に含めない。
+// 失敗したユーザーがいる場合も、取得できたユーザー情報は返却する。
+func (d *httpUserDirectory) findEach(ctx context.Context, ids []int) (map[int]entity.User, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	users := map[int]entity.User{}
+	sem := make(chan struct{}, userLookupConcurrency)
+
+	for _, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			var user entity.User
+			err := d.do(ctx, http.MethodGet, "/users/"+strconv.Itoa(id), nil, nil, &user)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if statusErr, ok := err.(*StatusError); ok && statusErr.Status == http.StatusNotFound {
+				return
+			}
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			users[id] = user
+		}(id)
+	}
+	wg.Wait()
+
+	return users, firstErr
+}
+
+func (d *httpUserDirectory) Authenticate(ctx context.Context, token string) (int, error) {
+	response := struct {
+		ID int
+	}{}
+	err := d.do(ctx, http.MethodGet, "/auth/"+url.PathEscape(token), nil, nil, &response)
+	if statusErr, ok := err.(*StatusError); ok && !statusErr.Temporary() {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return response.ID, nil
+}
+
+type httpPointLedger struct {
+	httpClient
+	serviceToken string
+}
+
+// NewHTTPPointLedger ポイントサービス(baseURL)へHTTPで問い合わせるPointLedgerを生成する。
+// リクエストはユーザーのトークンではなく、このサービス自身の認証情報(serviceToken)で行う。
+func NewHTTPPointLedger(baseURL string, serviceToken string, timeout time.Duration) PointLedger {
+	return httpPointLedger{httpClient: newHTTPClient(baseURL, timeout), serviceToken: serviceToken}
+}
+
+// header サービスの認証情報を設定したヘッダーを生成する。
+func (l httpPointLedger) header() http.Header {
+	header := http.Header{}
+	if l.serviceToken != "" {
+		header.Set("Authorization", "Bearer "+l.serviceToken)
+	}
+	return header
+}
+
+func (l httpPointLedger) Total(ctx context.Context, userID int) (int, error) {
+	response := struct {
+		Total int `json:"total"`
+	}{}
+	if err := l.do(ctx, http.MethodGet, "/sum/"+strconv.Itoa(userID), l.header(), nil, &response); err != nil {
+		return 0, err
+	}
+
+	return response.Total, nil
+}
+
+// Create 再送時に二重計上されないよう、冪等キーをヘッダーとボディの両方で送信する。
+func (l httpPointLedger) Create(ctx context.Context, entry PointEntry) error {
+	header := l.header()
+	header.Set("Idempotency-Key", entry.IdempotencyKey)
+
+	err := l.do(ctx, http.MethodPost, "/points", header, &entry, nil)
+	// 冪等キーにより既に登録済みと判断された場合は成功とみなす。
+	if statusErr, ok := err.(*StatusError); ok && statusErr.Status == http.StatusConflict {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+var testUsers = map[string]entity.User{
+	"1": {ID: 1, Name: "taro"},
+	"2": {ID: 2, Name: "yamada"},
+}
+
+func TestHTTPUserDirectory(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		switch r.URL.Path {
+		case "/users":
+			users := []entity.User{}
+			for _, id := range r.URL.Query()["id"] {
+				if user, ok := testUsers[id]; ok {
+					users = append(users, user)
+				}
+			}
+			json.NewEncoder(w).Encode(users)
+		case "/auth/testToken":
+			json.NewEncoder(w).Encode(map[string]int{"ID": 1})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	users := NewHTTPUserDirectory(server.URL, 0)
+	found, err := users.FindByIDs(context.Background(), []int{2, 3})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, map[int]entity.User{2: {ID: 2, Name: "yamada"}}, found)
+	assert.Equal(t, []string{"/users?id=2&id=3"}, requests)
+
+	userID, err := users.Authenticate(context.Background(), "testToken")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, userID)
+
+	_, err = users.Authenticate(context.Background(), "invalid")
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func TestHTTPUserDirectoryFallback(t *testing.T) {
+	tests := []struct {
+		name  string
+		users func(w http.ResponseWriter)
+	}{
+		{"not found", func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotFound) }},
+		{"bad request", func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadRequest) }},
+		{"filter ignored", func(w http.ResponseWriter) {
+			json.NewEncoder(w).Encode([]entity.User{testUsers["1"], testUsers["2"]})
+		}},
+	}
+
+	for _, test := range tests {
+		var batchRequests int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/users" {
+				batchRequests++
+				test.users(w)
+				return
+			}
+			user, ok := testUsers[r.URL.Path[len("/users/"):]]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(user)
+		}))
+
+		now := time.Now()
+		users := NewHTTPUserDirectory(server.URL, 0).(*httpUserDirectory)
+		users.now = func() time.Time { return now }
+		found, err := users.FindByIDs(context.Background(), []int{2, 3})
+		assert.Equal(t, nil, err, test.name)
+		assert.Equal(t, map[int]entity.User{2: testUsers["2"]}, found, test.name)
+
+		// 一括取得に対応していないと判断した後は1件ずつ取得する。
+		found, err = users.FindByIDs(context.Background(), []int{1, 2})
+		assert.Equal(t, nil, err, test.name)
+		assert.Equal(t, map[int]entity.User{1: testUsers["1"], 2: testUsers["2"]}, found, test.name)
+		assert.Equal(t, 1, batchRequests, test.name)
+
+		// 一定期間後は再度一括取得を試す。
+		now = now.Add(batchRetryInterval)
+		users.FindByIDs(context.Background(), []int{1, 2})
+		assert.Equal(t, 2, batchRequests, test.name)
+		server.Close()
+	}
+}
+
+func TestHTTPPointLedger(t *testing.T) {
+	status := http.StatusOK
+	var received PointEntry
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sum/1":
+			json.NewEncoder(w).Encode(map[string]int{"total": 1000})
+		case "/points":
+			assert.Equal(t, "post-1-pay", r.Header.Get("Idempotency-Key"))
+			assert.Equal(t, "Bearer serviceToken", r.Header.Get("Authorization"))
+			json.NewDecoder(r.Body).Decode(&received)
+			w.WriteHeader(status)
+		}
+	}))
+	defer server.Close()
+
+	points := NewHTTPPointLedger(server.URL, "serviceToken", 0)
+	total, err := points.Total(context.Background(), 1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1000, total)
+
+	entry := PointEntry{Number: -100, Comment: "test", UserID: 1, IdempotencyKey: "post-1-pay"}
+	assert.Equal(t, nil, points.Create(context.Background(), entry))
+	assert.Equal(t, entry, received)
+
+	// 登録済みの冪等キーは成功とみなす。
+	status = http.StatusConflict
+	assert.Equal(t, nil, points.Create(context.Background(), entry))
+
+	status = http.StatusServiceUnavailable
+	err = points.Create(context.Background(), entry)
+	assert.NotEqual(t, nil, err)
+	assert.False(t, IsRejected(err))
+
+	status = http.StatusBadRequest
+	assert.True(t, IsRejected(points.Create(context.Background(), entry)))
+}
+
+func TestHTTPClientTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	points := NewHTTPPointLedger(server.URL, "", 10*time.Millisecond)
+	_, err := points.Total(context.Background(), 1)
+	assert.NotEqual(t, nil, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	points = NewHTTPPointLedger(server.URL, "", 0)
+	_, err = points.Total(ctx, 1)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
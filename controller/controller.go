@@ -2,6 +2,7 @@ package controller
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -10,23 +11,36 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/SeijiOmi/posts-service/repository"
 	"github.com/SeijiOmi/posts-service/service"
 )
 
+var behavior service.Behavior
+
+// Init コントローラーが使用するBehaviorを設定する。
+func Init(b service.Behavior) {
+	behavior = b
+}
+
 // Index action: GET /posts
 func Index(c *gin.Context) {
-	offset, err := strconv.Atoi(c.Query("offset"))
+	page, legacy, err := bindPage(c)
 	if err != nil {
 		return
 	}
-	var b service.Behavior
-	p, err := b.GetAllAttachJoinData(offset)
+	query, err := service.ParsePostQuery(c.Request.URL.Query())
+	if err != nil {
+		abortListWithError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	b := behavior
+	p, err := b.FindAttachJoinData(c.Request.Context(), query, page)
 
 	if err != nil {
-		c.AbortWithStatus(http.StatusBadRequest)
-		fmt.Println(err)
+		abortListWithError(c, err, http.StatusBadRequest)
 	} else {
-		c.JSON(http.StatusOK, p)
+		renderPage(c, p, legacy)
 	}
 }
 
@@ -42,30 +56,78 @@ func Create(c *gin.Context) {
 	}
 	inputJoinPost.Post = inputPost
 
-	type tokenStru struct {
-		Token string `json:"token"`
+	b := behavior
+	createdPost, err := b.CreateModel(c.Request.Context(), inputJoinPost, authUser(c))
+
+	if err != nil {
+		abortWithError(c, err)
+	} else {
+		setPartialHeader(c, createdPost)
+		c.JSON(http.StatusCreated, createdPost)
 	}
-	var token tokenStru
-	if err := bindJSON(c, &token); err != nil {
+}
+
+// Show action: GET /posts/:id
+func Show(c *gin.Context) {
+	id := c.Params.ByName("id")
+	// ginでは/posts/:idと/posts/searchを同時に登録できないため、ここで振り分ける。
+	if id == "search" {
+		Search(c)
 		return
 	}
 
-	var b service.Behavior
-	createdPost, err := b.CreateModel(inputJoinPost, token.Token)
+	b := behavior
+	p, err := b.GetByID(id)
 
 	if err != nil {
-		c.AbortWithStatus(http.StatusBadRequest)
+		c.AbortWithStatus(http.StatusNotFound)
 		fmt.Println(err)
 	} else {
-		c.JSON(http.StatusCreated, createdPost)
+		c.JSON(http.StatusOK, p)
 	}
 }
 
-// Show action: GET /posts/:id
-func Show(c *gin.Context) {
+// Search action: GET /posts/search
+func Search(c *gin.Context) {
+	page, legacy, err := bindPage(c)
+	if err != nil {
+		return
+	}
+	query, err := service.ParsePostQuery(c.Request.URL.Query())
+	if err != nil {
+		abortListWithError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	b := behavior
+	p, err := b.SearchAttachJoinData(c.Request.Context(), query, page)
+
+	if err != nil {
+		abortListWithError(c, err, http.StatusBadRequest)
+	} else {
+		renderPage(c, p, legacy)
+	}
+}
+
+// History action: GET /posts/:id/history
+func History(c *gin.Context) {
 	id := c.Params.ByName("id")
-	var b service.Behavior
-	p, err := b.GetByID(id)
+	b := behavior
+	p, err := b.GetHistoryByPostID(id)
+
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		fmt.Println(err)
+	} else {
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+// Settlements action: GET /posts/:id/settlements
+func Settlements(c *gin.Context) {
+	id := c.Params.ByName("id")
+	b := behavior
+	p, err := b.GetSettlementsByPostID(id)
 
 	if err != nil {
 		c.AbortWithStatus(http.StatusNotFound)
@@ -78,17 +140,16 @@ func Show(c *gin.Context) {
 // Update action: PUT /posts/:id
 func Update(c *gin.Context) {
 	id := c.Params.ByName("id")
-	var inputPost entity.Post
-	if err := bindJSON(c, &inputPost); err != nil {
+	var input entity.PostUpdate
+	if err := bindJSON(c, &input); err != nil {
 		return
 	}
 
-	var b service.Behavior
-	p, err := b.UpdateByID(id, inputPost)
+	b := behavior
+	p, err := b.UpdateByID(c.Request.Context(), id, input, authUser(c))
 
 	if err != nil {
-		c.AbortWithStatus(http.StatusBadRequest)
-		fmt.Println(err)
+		abortWithError(c, err)
 	} else {
 		c.JSON(http.StatusCreated, p)
 	}
@@ -97,11 +158,10 @@ func Update(c *gin.Context) {
 // Delete action: DELETE /posts/:id
 func Delete(c *gin.Context) {
 	id := c.Params.ByName("id")
-	var b service.Behavior
 
-	if err := b.DeleteByID(id); err != nil {
-		c.AbortWithStatus(http.StatusBadRequest)
-		fmt.Println(err)
+	b := behavior
+	if err := b.DeleteByID(id, authUser(c)); err != nil {
+		abortWithError(c, err)
 	} else {
 		c.JSON(http.StatusCreated, gin.H{"id #" + id: "deleted"})
 	}
@@ -110,60 +170,53 @@ func Delete(c *gin.Context) {
 // UserShow action: get /user/:id
 func UserShow(c *gin.Context) {
 	id := c.Params.ByName("id")
-	offset, err := strconv.Atoi(c.Query("offset"))
+	page, legacy, err := bindPage(c)
 	if err != nil {
-		c.AbortWithStatus(http.StatusNotFound)
-		fmt.Println(err)
 		return
 	}
 
-	var b service.Behavior
-	p, err := b.GetByUserIDAttachJoinData(id, offset)
+	b := behavior
+	p, err := b.GetByUserIDAttachJoinData(c.Request.Context(), id, page)
 
 	if err != nil {
-		c.AbortWithStatus(http.StatusNotFound)
-		fmt.Println(err)
+		abortListWithError(c, err, http.StatusNotFound)
 	} else {
-		c.JSON(http.StatusOK, p)
+		renderPage(c, p, legacy)
 	}
 }
 
 // HelperShow action: get /helpser/:id
 func HelperShow(c *gin.Context) {
 	id := c.Params.ByName("id")
-	offset, err := strconv.Atoi(c.Query("offset"))
+	page, legacy, err := bindPage(c)
 	if err != nil {
-		c.AbortWithStatus(http.StatusNotFound)
-		fmt.Println(err)
 		return
 	}
 
-	var b service.Behavior
-	p, err := b.GetByHelperUserIDAttachJoinData(id, offset)
+	b := behavior
+	p, err := b.GetByHelperUserIDAttachJoinData(c.Request.Context(), id, page)
 
 	if err != nil {
-		c.AbortWithStatus(http.StatusNotFound)
-		fmt.Println(err)
+		abortListWithError(c, err, http.StatusNotFound)
 	} else {
-		c.JSON(http.StatusOK, p)
+		renderPage(c, p, legacy)
 	}
 }
 
 // SetHelpUser action: Post /helper
 func SetHelpUser(c *gin.Context) {
-	id, token, err := bindGetIDAndToken(c)
-	fmt.Println(id)
+	id, err := bindID(c)
 	if err != nil {
 		return
 	}
 
-	var b service.Behavior
-	p, err := b.SetHelpUserID(id, token)
+	b := behavior
+	p, err := b.SetHelpUserID(c.Request.Context(), id, authUser(c))
 
 	if err != nil {
-		c.AbortWithStatus(http.StatusBadRequest)
-		fmt.Println(err)
+		abortWithError(c, err)
 	} else {
+		setPartialHeader(c, p)
 		c.JSON(http.StatusCreated, p)
 	}
 }
@@ -171,36 +224,32 @@ func SetHelpUser(c *gin.Context) {
 // TakeHelpUser action: delete /helper
 func TakeHelpUser(c *gin.Context) {
 	id := c.Params.ByName("id")
-	_, token, err := bindGetIDAndToken(c)
-	if err != nil {
-		return
-	}
 
-	var b service.Behavior
-	p, err := b.TakeHelpUserID(id, token)
+	b := behavior
+	p, err := b.TakeHelpUserID(c.Request.Context(), id, authUser(c))
 
 	if err != nil {
-		c.AbortWithStatus(http.StatusBadRequest)
-		fmt.Println(err)
+		abortWithError(c, err)
 	} else {
+		setPartialHeader(c, p)
 		c.JSON(http.StatusCreated, p)
 	}
 }
 
 // DonePayment action: POST /done
 func DonePayment(c *gin.Context) {
-	id, token, err := bindGetIDAndToken(c)
+	id, err := bindID(c)
 	if err != nil {
 		return
 	}
 
-	var b service.Behavior
-	p, err := b.DonePayment(id, token)
+	b := behavior
+	p, err := b.DonePayment(c.Request.Context(), id, authUser(c))
 
 	if err != nil {
-		c.AbortWithStatus(http.StatusBadRequest)
-		fmt.Println(err)
+		abortWithError(c, err)
 	} else {
+		setPartialHeader(c, p)
 		c.JSON(http.StatusCreated, p)
 	}
 }
@@ -208,18 +257,14 @@ func DonePayment(c *gin.Context) {
 // DoneAcceptance action: PUT /done
 func DoneAcceptance(c *gin.Context) {
 	id := c.Params.ByName("id")
-	_, token, err := bindGetIDAndToken(c)
-	if err != nil {
-		return
-	}
 
-	var b service.Behavior
-	p, err := b.DoneAcceptance(id, token)
+	b := behavior
+	p, err := b.DoneAcceptance(c.Request.Context(), id, authUser(c))
 
 	if err != nil {
-		c.AbortWithStatus(http.StatusBadRequest)
-		fmt.Println(err)
+		abortWithError(c, err)
 	} else {
+		setPartialHeader(c, p)
 		c.JSON(http.StatusCreated, p)
 	}
 }
@@ -228,13 +273,20 @@ func DoneAcceptance(c *gin.Context) {
 func AmountPayment(c *gin.Context) {
 	id := c.Params.ByName("id")
 
-	var b service.Behavior
-	p, err := b.GetAmountPaymentByUserID(id)
+	b := behavior
+	p, err := b.GetBalanceByUserID(c.Request.Context(), id)
 
+	// AmountPaymentは旧クライアント向け。Availableと同じ値。
 	response := struct {
 		AmountPayment int
+		Total         int
+		Held          int
+		Available     int
 	}{
-		p,
+		p.Available,
+		p.Total,
+		p.Held,
+		p.Available,
 	}
 
 	if err != nil {
@@ -248,29 +300,27 @@ func AmountPayment(c *gin.Context) {
 // TagShow action: GET /tag/id
 func TagShow(c *gin.Context) {
 	id := c.Params.ByName("id")
-	offset, err := strconv.Atoi(c.Query("offset"))
+	page, legacy, err := bindPage(c)
 	if err != nil {
-		c.AbortWithStatus(http.StatusNotFound)
-		fmt.Println(err)
 		return
 	}
 
-	var b service.Behavior
-	p, err := b.GetByTagIDAttachJoinData(id, offset)
+	b := behavior
+	p, err := b.GetByTagIDAttachJoinData(c.Request.Context(), id, page)
 
 	if err != nil {
-		c.AbortWithStatus(http.StatusNotFound)
-		fmt.Println(err)
+		abortListWithError(c, err, http.StatusNotFound)
 	} else {
-		c.JSON(http.StatusOK, p)
+		renderPage(c, p, legacy)
 	}
 }
 
 // TagLike action: GET /tag/like
+// 旧クライアント向け。件数の上限や並び順が無いため、入力補完にはTagSuggestを使う。
 func TagLike(c *gin.Context) {
 	id := c.Params.ByName("id")
 
-	var b service.Behavior
+	b := behavior
 	p, err := b.FindTagLikeBody(id)
 
 	if err != nil {
@@ -281,17 +331,273 @@ func TagLike(c *gin.Context) {
 	}
 }
 
-func bindGetIDAndToken(c *gin.Context) (string, string, error) {
+// TagIndex action: GET /tags
+func TagIndex(c *gin.Context) {
+	b := behavior
+	p, err := b.GetTags()
+
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		fmt.Println(err)
+	} else {
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+// TagTrending action: GET /tags/trending
+func TagTrending(c *gin.Context) {
+	var query service.TrendingQuery
+	var err error
+	query.Window = c.Query("window")
+	if open := c.Query("open"); open != "" {
+		if query.OpenOnly, err = strconv.ParseBool(open); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_filter", "param": "open"})
+			fmt.Println(err)
+			return
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_limit"})
+			fmt.Println(err)
+			return
+		}
+	}
+
+	b := behavior
+	p, err := b.GetTrendingTags(query)
+
+	if err != nil {
+		abortListWithError(c, err, http.StatusInternalServerError)
+	} else {
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+// TagSuggest action: GET /tags/suggest
+func TagSuggest(c *gin.Context) {
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_limit"})
+			fmt.Println(err)
+			return
+		}
+	}
+
+	b := behavior
+	p, err := b.GetTagSuggestions(c.Query("q"), limit)
+
+	if err != nil {
+		abortListWithError(c, err, http.StatusInternalServerError)
+	} else {
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+// TagRename action: PUT /tags/:id
+func TagRename(c *gin.Context) {
+	id := c.Params.ByName("id")
+	var input struct {
+		Body string `json:"body"`
+	}
+	if err := bindJSON(c, &input); err != nil {
+		return
+	}
+
+	b := behavior
+	p, err := b.RenameTag(id, input.Body)
+
+	if err != nil {
+		abortTagWithError(c, err)
+	} else {
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+// TagMerge action: POST /tags/:id/merge
+func TagMerge(c *gin.Context) {
+	id := c.Params.ByName("id")
+	var input struct {
+		Into uint `json:"into"`
+	}
+	if err := bindJSON(c, &input); err != nil {
+		return
+	}
+
+	b := behavior
+	p, err := b.MergeTag(id, input.Into)
+
+	if err != nil {
+		abortTagWithError(c, err)
+	} else {
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+// TagDelete action: DELETE /tags/:id
+func TagDelete(c *gin.Context) {
+	id := c.Params.ByName("id")
+
+	b := behavior
+	if err := b.DeleteTag(id); err != nil {
+		abortTagWithError(c, err)
+	} else {
+		c.JSON(http.StatusOK, gin.H{"id #" + id: "deleted"})
+	}
+}
+
+// abortTagWithError タグ管理のエラー種別に応じたステータスで処理を中断する。
+func abortTagWithError(c *gin.Context, err error) {
+	fmt.Println(err)
+
+	var conflict *service.TagConflictError
+	if errors.As(err, &conflict) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "tag_conflict", "tagId": conflict.TagID})
+		return
+	}
+
+	var inUse *service.TagInUseError
+	if errors.As(err, &inUse) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "tag_in_use", "postCount": inUse.PostCount})
+		return
+	}
+
+	if errors.Is(err, repository.ErrNotFound) {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	c.AbortWithStatus(http.StatusBadRequest)
+}
+
+// abortWithError サービスのエラー種別に応じたステータスで処理を中断する。
+func abortWithError(c *gin.Context, err error) {
+	fmt.Println(err)
+
+	var forbidden *service.ForbiddenError
+	if errors.As(err, &forbidden) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden", "reason": forbidden.Reason})
+		return
+	}
+
+	var transition *service.TransitionError
+	if errors.As(err, &transition) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error":  "invalid_transition",
+			"status": transition.From.String(),
+			"event":  transition.Event,
+		})
+		return
+	}
+
+	if errors.Is(err, service.ErrPostChanged) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "post_changed"})
+		return
+	}
+
+	if errors.Is(err, service.ErrSettlementUserUnresolved) {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "user_unavailable"})
+		return
+	}
+
+	var insufficient *service.InsufficientPointsError
+	if errors.As(err, &insufficient) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":     "insufficient_points",
+			"balance":   insufficient.Balance,
+			"committed": insufficient.Committed,
+			"requested": insufficient.Requested,
+		})
+		return
+	}
+
+	c.AbortWithStatus(http.StatusBadRequest)
+}
+
+// bindPage 一覧取得のページ指定をクエリから取得する。
+// cursorが無くoffsetが指定された場合は旧形式(配列)で返却するため、legacyをtrueとする。
+func bindPage(c *gin.Context) (service.Page, bool, error) {
+	var page service.Page
+	var err error
+
+	if limit := c.Query("limit"); limit != "" {
+		if page.Limit, err = strconv.Atoi(limit); err != nil || page.Limit <= 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_limit"})
+			fmt.Println(err)
+			return page, false, errors.New("invalid limit")
+		}
+	}
+
+	page.Cursor = c.Query("cursor")
+	offset := c.Query("offset")
+	if page.Cursor != "" || offset == "" {
+		return page, false, nil
+	}
+
+	if page.Offset, err = strconv.Atoi(offset); err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		fmt.Println(err)
+		return page, true, err
+	}
+	return page, true, nil
+}
+
+// renderPage 投稿情報一覧を返却する。legacyの場合は旧形式(配列)で返却する。
+func renderPage(c *gin.Context, page entity.PostPage, legacy bool) {
+	setPartialHeader(c, page.Items...)
+	if legacy {
+		c.JSON(http.StatusOK, page.Items)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// abortListWithError 一覧取得のエラーで処理を中断する。cursor・絞り込み条件が不正な場合は400とする。
+func abortListWithError(c *gin.Context, err error, status int) {
+	fmt.Println(err)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_cursor"})
+		return
+	}
+
+	var invalid *service.InvalidFilterError
+	if errors.As(err, &invalid) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_filter", "param": invalid.Param})
+		return
+	}
+	c.AbortWithStatus(status)
+}
+
+// PartialHeader ユーザー情報を取得できなかった投稿情報を含む場合に設定するレスポンスヘッダー
+const PartialHeader = "X-Partial-Content"
+
+// setPartialHeader ユーザー情報を取得できなかった投稿情報を含む場合にレスポンスヘッダーで知らせる。
+func setPartialHeader(c *gin.Context, joinPosts ...entity.JoinPost) {
+	if service.IsPartial(joinPosts...) {
+		c.Header(PartialHeader, "users")
+	}
+}
+
+// AuthUserKey 認証ミドルウェアが解決したユーザーを格納するgin.Contextのキー
+const AuthUserKey = "authUser"
+
+// authUser 認証ミドルウェアで解決済みのリクエストユーザーを取得する。
+func authUser(c *gin.Context) entity.AuthUser {
+	return c.MustGet(AuthUserKey).(entity.AuthUser)
+}
+
+func bindID(c *gin.Context) (string, error) {
 	type requestStru struct {
-		ID    float64 `json:"id"`
-		Token string  `json:"token"`
+		ID float64 `json:"id"`
 	}
 	var request requestStru
 	if err := bindJSON(c, &request); err != nil {
-		return "", "", err
+		return "", err
 	}
 
-	return strconv.Itoa(int(request.ID)), request.Token, nil
+	return strconv.Itoa(int(request.ID)), nil
 }
 
 func bindJSON(c *gin.Context, data interface{}) error {
@@ -13,7 +13,6 @@ import (
 
 var (
 	db  *gorm.DB
-	tx  *gorm.DB
 	err error
 )
 
@@ -37,30 +36,9 @@ func Init() {
 
 // GetDB DB接続情報取得
 func GetDB() *gorm.DB {
-	if tx != nil {
-		return tx
-	}
 	return db
 }
 
-// StartBegin トランザクションを開始する。
-func StartBegin() *gorm.DB {
-	tx = db.Begin()
-	return tx
-}
-
-// EndRollback トランザクションを終了しロールバックする。
-func EndRollback() {
-	tx.Rollback()
-	tx = nil
-}
-
-// EndCommit トランザクションを終了しコミットする。
-func EndCommit() {
-	tx.Commit()
-	tx = nil
-}
-
 // Close DB切断
 func Close() {
 	if err := db.Close(); err != nil {
@@ -70,6 +48,73 @@ func Close() {
 
 func autoMigration() {
 	db.AutoMigrate(&entity.Post{})
+	migrateLegacyMatched()
+	createPostBodyFullTextIndex()
 	db.AutoMigrate(&entity.Tag{})
+	dropTagBodyUniqueIndex()
 	db.AutoMigrate(&entity.PostTag{})
+	db.AutoMigrate(&entity.PostEvent{})
+	db.AutoMigrate(&entity.Settlement{})
+	dropSettlementToken()
+	db.AutoMigrate(&entity.UserLock{})
+	db.AutoMigrate(&entity.Hold{})
+	backfillHolds()
+	backfillPostCreatedAt()
+}
+
+// migrateLegacyMatched 状態管理の導入前にヘルパーが決まった投稿は状態がNone(Open)のままのため、Matchedに更新する。
+// 一覧の絞り込みや集計は保存された状態で行うため、読み込み時の読み替えだけでは足りない。
+func migrateLegacyMatched() {
+	db.Exec("UPDATE posts SET status = ? WHERE status = ? AND helper_user_id <> 0", entity.Matched, entity.Open)
+}
+
+// postBodyFullTextIndex 投稿本文の全文検索用インデックス名
+const postBodyFullTextIndex = "idx_posts_body_fulltext"
+
+// createPostBodyFullTextIndex 投稿本文の全文検索用インデックスを作成する。
+// 日本語は単語が空白で区切られないため、ngramパーサーを使用する。
+func createPostBodyFullTextIndex() {
+	if db.Dialect().HasIndex("posts", postBodyFullTextIndex) {
+		return
+	}
+	if err := db.Exec("ALTER TABLE posts ADD FULLTEXT INDEX " + postBodyFullTextIndex + " (body) WITH PARSER ngram").Error; err != nil {
+		fmt.Println(err)
+	}
+}
+
+// tagBodyUniqueIndex タグ名の一意制約。照合はslugで行うため、表記違いのタグ名を登録できるよう削除する。
+const tagBodyUniqueIndex = "uix_tags_body"
+
+// dropTagBodyUniqueIndex タグ名の一意制約を削除する。同じタグ名のタグの統合はslugの設定時に行う。
+func dropTagBodyUniqueIndex() {
+	if db.Dialect().HasIndex("tags", tagBodyUniqueIndex) {
+		db.Model(&entity.Tag{}).RemoveIndex(tagBodyUniqueIndex)
+	}
+}
+
+// dropSettlementToken 旧処理で精算に保存していたユーザーのトークンを削除する。
+// 精算はサービスの認証情報で配信するため、トークンは不要。
+func dropSettlementToken() {
+	if db.Dialect().HasColumn("settlements", "token") {
+		db.Model(&entity.Settlement{}).DropColumn("token")
+	}
+}
+
+// backfillHolds エスクロー導入前の投稿について確保中ポイントを作成する。
+// 支払済み・受け取り待ちの投稿は、旧処理で投稿者の支払が計上済みのためfundedとする。
+func backfillHolds() {
+	db.Exec(`INSERT INTO holds (post_id, user_id, point, status, funded, created_at, updated_at)
+		SELECT id, user_id, point, ?, status = ?, NOW(), NOW() FROM posts
+		WHERE status IN (?) AND id NOT IN (SELECT post_id FROM holds)`,
+		entity.HoldHeld, entity.Paid,
+		[]entity.Status{entity.Open, entity.Matched, entity.Paid},
+	)
+}
+
+// backfillPostCreatedAt 作成日時の導入前の投稿について、最初の状態遷移履歴の日時を作成日時とする。
+// 履歴も無い投稿は移行時点の日時とする。
+func backfillPostCreatedAt() {
+	db.Exec(`UPDATE posts SET created_at = COALESCE(
+		(SELECT MIN(post_events.created_at) FROM post_events WHERE post_events.post_id = posts.id), NOW())
+		WHERE created_at IS NULL`)
 }
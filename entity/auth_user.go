@@ -0,0 +1,7 @@
+package entity
+
+// AuthUser 認証済みのリクエストユーザー
+type AuthUser struct {
+	ID    int
+	Token string
+}
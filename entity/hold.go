@@ -0,0 +1,38 @@
+package entity
+
+import "time"
+
+// HoldStatus エスクローの状態
+type HoldStatus string
+
+const (
+	// HoldHeld 投稿者のポイントを確保中
+	HoldHeld HoldStatus = "held"
+	// HoldReleased 確保を解除し投稿者に戻した
+	HoldReleased HoldStatus = "released"
+	// HoldCaptured ヘルパーへ支払済み
+	HoldCaptured HoldStatus = "captured"
+)
+
+// Hold 投稿に対して確保した投稿者のポイント（エスクロー）
+type Hold struct {
+	ID     uint       `json:"id"`
+	PostID uint       `json:"postId" gorm:"unique_index"`
+	UserID uint       `json:"userId" gorm:"index"`
+	Point  int        `json:"point"`
+	Status HoldStatus `json:"status"`
+	// Funded 投稿者の支払がポイントサービスに計上済みか
+	Funded    bool      `json:"funded"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// PointBalance ユーザーのポイント残高
+type PointBalance struct {
+	// Total 保有ポイント（エスクローに預けている分を含む）
+	Total int `json:"total"`
+	// Held エスクローで確保中のポイント
+	Held int `json:"held"`
+	// Available 新たに投稿に使用できるポイント
+	Available int `json:"available"`
+}
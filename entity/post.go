@@ -1,23 +1,69 @@
 package entity
 
+import "time"
+
 // Status 投稿情報の状態を示す。
+// DBや状態遷移履歴に保存済みの値と互換を保つため、既存の値は変更しないこと。
 type Status int
 
+const (
+	// Open 投稿完了（ヘルパー募集中）
+	Open Status = iota
+	// Paid 投稿者支払完了
+	Paid
+	// Accepted ヘルパー受け取り完了
+	Accepted
+	// Matched ヘルパー決定済み
+	Matched
+	// 4は欠番（お手伝い実施中。遷移させる操作が無いため削除した）
+	_
+	// Cancelled 投稿者による取り消し
+	Cancelled
+)
+
+// 旧ステータス名。既存の呼び出し元のために残している。
 const (
 	// None 投稿完了
-	None Status = iota
+	None = Open
 	// Payment 投稿者支払完了
-	Payment
+	Payment = Paid
 	// Acceptance ヘルパー受け取り完了
-	Acceptance
+	Acceptance = Accepted
 )
 
+var statusNames = map[Status]string{
+	Open:      "open",
+	Paid:      "paid",
+	Accepted:  "accepted",
+	Matched:   "matched",
+	Cancelled: "cancelled",
+}
+
+// String ステータス名を返却する。
+func (s Status) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseStatus ステータス名から状態を取得する。
+func ParseStatus(name string) (Status, bool) {
+	for status, n := range statusNames {
+		if n == name {
+			return status, true
+		}
+	}
+	return 0, false
+}
+
 // Post オブジェクト構造
 type Post struct {
-	ID           uint   `json:"id"`
-	UserID       uint   `json:"userId"`
-	HelperUserID uint   `json:"helperUserId"`
-	Body         string `json:"body"`
-	Point        uint   `json:"point" binding:"numeric,min=0"`
-	Status       Status `json:"status"`
+	ID           uint      `json:"id"`
+	UserID       uint      `json:"userId"`
+	HelperUserID uint      `json:"helperUserId"`
+	Body         string    `json:"body"`
+	Point        uint      `json:"point" binding:"numeric,min=0"`
+	Status       Status    `json:"status"`
+	CreatedAt    time.Time `json:"createdAt" gorm:"index"`
 }
@@ -0,0 +1,15 @@
+package entity
+
+import "time"
+
+// PostEvent 投稿情報の状態遷移履歴
+type PostEvent struct {
+	ID           uint      `json:"id"`
+	PostID       uint      `json:"postId" gorm:"index"`
+	Event        string    `json:"event"`
+	ActorUserID  uint      `json:"actorUserId"`
+	OldStatus    Status    `json:"oldStatus"`
+	NewStatus    Status    `json:"newStatus"`
+	HelperUserID uint      `json:"helperUserId"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
@@ -0,0 +1,9 @@
+package entity
+
+// PostPage 投稿情報一覧の1ページ分
+type PostPage struct {
+	Items []JoinPost `json:"items"`
+	// NextCursor 次のページを取得する際にcursorとして指定する値。次のページが無い場合は空。
+	NextCursor string `json:"next_cursor"`
+	HasMore    bool   `json:"has_more"`
+}
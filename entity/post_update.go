@@ -0,0 +1,12 @@
+package entity
+
+// PostUpdate 投稿情報の更新入力。クライアントが変更可能な項目(本文・ポイント・タグ)のみを持つ。
+// 指定されなかった項目(nil)は変更しない。投稿者・ヘルパー・状態は変更できない。
+type PostUpdate struct {
+	Body  *string `json:"body"`
+	Point *uint   `json:"point" binding:"omitempty,numeric,min=0"`
+	// Tags 指定された場合は投稿情報のタグをこの一覧に置き換える。空の一覧は全てのタグを外す。
+	Tags *[]Tag `json:"tags"`
+	// PruneTags trueの場合、外したタグがどの投稿情報にも付いていなければ削除する。
+	PruneTags bool `json:"pruneTags"`
+}
@@ -0,0 +1,34 @@
+package entity
+
+import "time"
+
+// SettlementStatus ポイント精算の配信状態
+type SettlementStatus string
+
+const (
+	// SettlementPending 配信待ち（再送対象）
+	SettlementPending SettlementStatus = "pending"
+	// SettlementDelivered 配信済み
+	SettlementDelivered SettlementStatus = "delivered"
+	// SettlementFailed 配信失敗（再送しない）
+	SettlementFailed SettlementStatus = "failed"
+)
+
+// Settlement ポイントサービスへ配信するポイント精算
+// 投稿情報の状態変更と同一トランザクションで登録し、後から配信する。
+type Settlement struct {
+	ID             uint             `json:"id"`
+	PostID         uint             `json:"postId" gorm:"index"`
+	Transition     string           `json:"transition"`
+	IdempotencyKey string           `json:"idempotencyKey" gorm:"unique_index"`
+	UserID         uint             `json:"userId"`
+	Point          int              `json:"point"`
+	Comment        string           `json:"comment"`
+	Status         SettlementStatus `json:"status" gorm:"index"`
+	Attempts       int              `json:"attempts"`
+	LastError      string           `json:"lastError"`
+	NextAttemptAt  time.Time        `json:"nextAttemptAt"`
+	DeliveredAt    *time.Time       `json:"deliveredAt"`
+	CreatedAt      time.Time        `json:"createdAt"`
+	UpdatedAt      time.Time        `json:"updatedAt"`
+}
@@ -2,6 +2,15 @@ package entity
 
 // Tag 投稿情報のタグ情報
 type Tag struct {
-	ID   uint   `json:"id"`
+	ID uint `json:"id"`
+	// Body 表示用のタグ名。入力された表記のまま保持する。
 	Body string `json:"body"`
+	// Slug 照合用に正規化したタグ名
+	Slug string `json:"slug" gorm:"unique_index"`
+}
+
+// TagCount タグ情報とタグが付いた投稿情報の件数
+type TagCount struct {
+	Tag
+	PostCount int `json:"postCount"`
 }
@@ -4,4 +4,6 @@ package entity
 type User struct {
 	ID   int    `json:"id"`
 	Name string `json:"name"`
+	// Unresolved ユーザーサービスに問い合わせできず、ユーザー情報を取得できなかった。
+	Unresolved bool `json:"unresolved,omitempty"`
 }
@@ -0,0 +1,6 @@
+package entity
+
+// UserLock ユーザー単位で処理を直列化するためのロック用レコード
+type UserLock struct {
+	UserID uint `gorm:"primary_key;auto_increment:false"`
+}
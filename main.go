@@ -1,12 +1,57 @@
 package main
 
 import (
+	"expvar"
+	"os"
+	"time"
+
+	"github.com/SeijiOmi/posts-service/client"
 	"github.com/SeijiOmi/posts-service/db"
+	"github.com/SeijiOmi/posts-service/repository"
 	"github.com/SeijiOmi/posts-service/server"
+	"github.com/SeijiOmi/posts-service/service"
 )
 
 func main() {
 	db.Init()
-	server.Init()
+	verifier, err := service.LoadJWTVerifier()
+	if err != nil {
+		panic(err)
+	}
+	admins, err := service.LoadAdminUserIDs()
+	if err != nil {
+		panic(err)
+	}
+	cacheConfig, err := client.LoadCacheConfig()
+	if err != nil {
+		panic(err)
+	}
+	// ユーザーサービスが5回連続で失敗した場合は30秒間問い合わせを止める。
+	breaker := client.NewCircuitBreakerUserDirectory(
+		client.NewHTTPUserDirectory(os.Getenv("USER_URL"), client.DefaultTimeout),
+		5,
+		30*time.Second,
+	)
+	users := client.NewCachingUserDirectory(breaker, cacheConfig)
+	expvar.Publish("user_breaker", breaker.Stats())
+	expvar.Publish("user_cache", users.Stats())
+
+	b := service.NewBehavior(
+		repository.NewGormStore(db.GetDB()),
+		users,
+		client.NewHTTPPointLedger(os.Getenv("POINT_URL"), os.Getenv("POINT_SERVICE_TOKEN"), client.DefaultTimeout),
+	)
+	b.TagNormalizer = service.LoadTagNormalizer()
+	b.Verifier = verifier
+	b.AdminUserIDs = admins
+	if err := b.BackfillTagSlugs(); err != nil {
+		panic(err)
+	}
+	if err := b.RefreshTagSuggestions(); err != nil {
+		panic(err)
+	}
+	b.StartTagSuggestRefresher(time.Minute)
+	b.StartSettlementWorker(30 * time.Second)
+	server.Init(b)
 	db.Close()
 }
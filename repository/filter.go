@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+// Sort 投稿情報一覧の並び順
+type Sort int
+
+const (
+	// SortNewest 新しい順
+	SortNewest Sort = iota
+	// SortOldest 古い順
+	SortOldest
+	// SortPoint ポイントの高い順。同じポイントの場合は新しい順
+	SortPoint
+	// SortRelevance Textとの関連度の高い順。同じ関連度の場合は新しい順。
+	// 関連度は投稿の増減で変わるため、取得範囲はPage.Afterではなく件数(Page.Offset)で指定する。
+	// Textが空の場合は新しい順とする。
+	SortRelevance
+)
+
+// PostFilter 投稿情報一覧の絞り込み条件。ゼロ値の項目は絞り込みに使用しない。
+type PostFilter struct {
+	// Text 本文の全文検索。いずれかの語を含む投稿情報に一致する。
+	Text string
+	// Statuses いずれかの状態に一致する。
+	Statuses []entity.Status
+	MinPoint *uint
+	MaxPoint *uint
+	UserID   *uint
+	// HelperUserID 0を指定した場合はヘルパー未決定の投稿情報に一致する。
+	HelperUserID *uint
+	TagIDs       []uint
+	// AllTags trueの場合はTagIDsの全てのタグが付いた投稿情報、falseの場合はいずれかのタグが付いた投稿情報に一致する。
+	AllTags bool
+	// CreatedFrom この時刻以降に作成された投稿情報に一致する。
+	CreatedFrom *time.Time
+	// CreatedBefore この時刻より前に作成された投稿情報に一致する。
+	CreatedBefore *time.Time
+	Sort          Sort
+}
+
+// distinctTagIDs 重複を除いたタグIDを取得する。
+func (f PostFilter) distinctTagIDs() []uint {
+	seen := map[uint]bool{}
+	var ids []uint
+	for _, id := range f.TagIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
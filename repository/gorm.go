@@ -0,0 +1,426 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+)
+
+// mysqlDuplicateEntry 一意制約違反のエラー番号
+const mysqlDuplicateEntry = 1062
+
+type gormStore struct {
+	db   *gorm.DB
+	inTx bool
+}
+
+// NewGormStore GORM(MySQL)を使用したStoreを生成する。
+func NewGormStore(db *gorm.DB) Store {
+	return &gormStore{db: db}
+}
+
+func (s *gormStore) Posts() PostRepository             { return gormPostRepository{s.db} }
+func (s *gormStore) Tags() TagRepository               { return gormTagRepository{s.db} }
+func (s *gormStore) PostTags() PostTagRepository       { return gormPostTagRepository{s.db} }
+func (s *gormStore) PostEvents() PostEventRepository   { return gormPostEventRepository{s.db} }
+func (s *gormStore) Settlements() SettlementRepository { return gormSettlementRepository{s.db} }
+func (s *gormStore) Holds() HoldRepository             { return gormHoldRepository{s.db} }
+
+// LockUser ロック用レコードを行ロックする。ロックはトランザクション終了時に解放される。
+func (s *gormStore) LockUser(userID uint) error {
+	if err := s.db.Exec("INSERT IGNORE INTO user_locks (user_id) VALUES (?)", userID).Error; err != nil {
+		return err
+	}
+
+	var lock entity.UserLock
+	return s.db.Set("gorm:query_option", "FOR UPDATE").Where("user_id = ?", userID).First(&lock).Error
+}
+
+// Transaction トランザクション内で呼び出された場合は、そのトランザクションのままfnを実行する。
+func (s *gormStore) Transaction(fn func(Store) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(&gormStore{db: tx, inTx: true}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// convertError GORM・MySQLのエラーをリポジトリのエラーに変換する。
+func convertError(err error) error {
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrNotFound
+	}
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == mysqlDuplicateEntry {
+		return ErrDuplicate
+	}
+	return err
+}
+
+type gormPostRepository struct {
+	db *gorm.DB
+}
+
+// matchBody 本文の全文検索の条件。posts.bodyのngramパーサーによるFULLTEXTインデックスを使用する。
+const matchBody = "MATCH (posts.body) AGAINST (? IN NATURAL LANGUAGE MODE)"
+
+// sortPage filter.Sortの順に並べ替えて取得範囲を適用する。
+func sortPage(db *gorm.DB, filter PostFilter, page Page) *gorm.DB {
+	after := page.After
+	sort := filter.Sort
+	if sort == SortRelevance && filter.Text == "" {
+		sort = SortNewest
+	}
+
+	switch sort {
+	case SortRelevance:
+		db = db.Select("posts.*, "+matchBody+" AS relevance", filter.Text).
+			Order("relevance desc").Order("posts.id desc")
+	case SortOldest:
+		if after != nil {
+			db = db.Where("posts.id > ?", after.ID)
+		}
+		db = db.Order("posts.id asc")
+	case SortPoint:
+		if after != nil {
+			db = db.Where("posts.point < ? OR (posts.point = ? AND posts.id < ?)", after.Point, after.Point, after.ID)
+		}
+		db = db.Order("posts.point desc").Order("posts.id desc")
+	default:
+		if after != nil {
+			db = db.Where("posts.id < ?", after.ID)
+		}
+		db = db.Order("posts.id desc")
+	}
+	return db.Offset(page.Offset).Limit(page.Limit)
+}
+
+// filterPosts 絞り込み条件を適用する。
+func filterPosts(db *gorm.DB, filter PostFilter) *gorm.DB {
+	if filter.Text != "" {
+		db = db.Where(matchBody, filter.Text)
+	}
+	if len(filter.Statuses) > 0 {
+		db = db.Where("posts.status IN (?)", filter.Statuses)
+	}
+	if filter.MinPoint != nil {
+		db = db.Where("posts.point >= ?", *filter.MinPoint)
+	}
+	if filter.MaxPoint != nil {
+		db = db.Where("posts.point <= ?", *filter.MaxPoint)
+	}
+	if filter.UserID != nil {
+		db = db.Where("posts.user_id = ?", *filter.UserID)
+	}
+	if filter.HelperUserID != nil {
+		db = db.Where("posts.helper_user_id = ?", *filter.HelperUserID)
+	}
+	if filter.CreatedFrom != nil {
+		db = db.Where("posts.created_at >= ?", *filter.CreatedFrom)
+	}
+	if filter.CreatedBefore != nil {
+		db = db.Where("posts.created_at < ?", *filter.CreatedBefore)
+	}
+
+	tagIDs := filter.distinctTagIDs()
+	switch {
+	case len(tagIDs) == 0:
+	case filter.AllTags:
+		db = db.Where(`posts.id IN (SELECT post_id FROM post_tags WHERE tag_id IN (?)
+			GROUP BY post_id HAVING COUNT(DISTINCT tag_id) = ?)`, tagIDs, len(tagIDs))
+	default:
+		db = db.Where("posts.id IN (SELECT post_id FROM post_tags WHERE tag_id IN (?))", tagIDs)
+	}
+	return db
+}
+
+func (r gormPostRepository) Find(filter PostFilter, page Page) ([]entity.Post, error) {
+	var posts []entity.Post
+	err := sortPage(filterPosts(r.db, filter), filter, page).Find(&posts).Error
+	return posts, convertError(err)
+}
+
+func (r gormPostRepository) FindByID(id uint) (entity.Post, error) {
+	var post entity.Post
+	err := r.db.Where("id = ?", id).First(&post).Error
+	return post, convertError(err)
+}
+
+func (r gormPostRepository) FindByIDForUpdate(id uint) (entity.Post, error) {
+	var post entity.Post
+	err := r.db.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", id).First(&post).Error
+	return post, convertError(err)
+}
+
+func (r gormPostRepository) Create(post *entity.Post) error {
+	return convertError(r.db.Create(post).Error)
+}
+
+func (r gormPostRepository) Save(post *entity.Post) error {
+	return convertError(r.db.Save(post).Error)
+}
+
+func (r gormPostRepository) Delete(id uint) error {
+	return convertError(r.db.Where("id = ?", id).Delete(&entity.Post{}).Error)
+}
+
+type gormTagRepository struct {
+	db *gorm.DB
+}
+
+func (r gormTagRepository) FindBySlug(slug string) (entity.Tag, error) {
+	var tag entity.Tag
+	err := r.db.Where("slug = ?", slug).First(&tag).Error
+	return tag, convertError(err)
+}
+
+func (r gormTagRepository) FindLikeSlug(slug string) ([]entity.Tag, error) {
+	var tags []entity.Tag
+	err := r.db.Where("slug LIKE ?", "%"+slug+"%").Find(&tags).Error
+	return tags, convertError(err)
+}
+
+func (r gormTagRepository) FindByPostID(postID uint) ([]entity.Tag, error) {
+	var tags []entity.Tag
+	err := r.db.
+		Select("tags.*").
+		Joins("inner join post_tags on tags.id = post_tags.tag_id").
+		Where("post_tags.post_id = ?", postID).
+		Find(&tags).Error
+	return tags, convertError(err)
+}
+
+func (r gormTagRepository) FindByPostIDs(postIDs []uint) (map[uint][]entity.Tag, error) {
+	tags := map[uint][]entity.Tag{}
+	if len(postIDs) == 0 {
+		return tags, nil
+	}
+
+	var rows []struct {
+		entity.Tag
+		PostID uint
+	}
+	err := r.db.
+		Table("tags").
+		Select("tags.*, post_tags.post_id").
+		Joins("inner join post_tags on tags.id = post_tags.tag_id").
+		Where("post_tags.post_id IN (?)", postIDs).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	for _, row := range rows {
+		tags[row.PostID] = append(tags[row.PostID], row.Tag)
+	}
+	return tags, nil
+}
+
+func (r gormTagRepository) FindByID(id uint) (entity.Tag, error) {
+	var tag entity.Tag
+	err := r.db.Where("id = ?", id).First(&tag).Error
+	return tag, convertError(err)
+}
+
+func (r gormTagRepository) FindAllWithCount() ([]entity.TagCount, error) {
+	tags := []entity.TagCount{}
+	err := r.db.
+		Table("tags").
+		Select("tags.*, COUNT(DISTINCT posts.id) AS post_count").
+		Joins("left join post_tags on tags.id = post_tags.tag_id").
+		Joins("left join posts on posts.id = post_tags.post_id").
+		Group("tags.id").
+		Order("tags.id asc").
+		Scan(&tags).Error
+	return tags, convertError(err)
+}
+
+func (r gormTagRepository) FindTrending(since time.Time, statuses []entity.Status, limit int) ([]entity.TagCount, error) {
+	db := r.db.
+		Table("tags").
+		Select("tags.*, COUNT(DISTINCT posts.id) AS post_count").
+		Joins("inner join post_tags on tags.id = post_tags.tag_id").
+		Joins("inner join posts on posts.id = post_tags.post_id").
+		Where("posts.created_at >= ?", since)
+	if len(statuses) > 0 {
+		db = db.Where("posts.status IN (?)", statuses)
+	}
+
+	tags := []entity.TagCount{}
+	err := db.Group("tags.id").Order("post_count desc").Order("tags.id asc").Limit(limit).Scan(&tags).Error
+	return tags, convertError(err)
+}
+
+func (r gormTagRepository) CountPosts(tagID uint) (int, error) {
+	var count int
+	err := r.db.
+		Table("post_tags").
+		Joins("inner join posts on posts.id = post_tags.post_id").
+		Where("post_tags.tag_id = ?", tagID).
+		Select("COUNT(DISTINCT post_tags.post_id)").
+		Row().Scan(&count)
+	return count, convertError(err)
+}
+
+func (r gormTagRepository) Create(tag *entity.Tag) error {
+	return convertError(r.db.Create(tag).Error)
+}
+
+// FindOrCreate 登録済みの場合は何もしない挿入の後、共有ロックで読み込み、他のトランザクションが作成したタグも取得する。
+func (r gormTagRepository) FindOrCreate(tag entity.Tag) (entity.Tag, error) {
+	if err := r.db.Exec("INSERT IGNORE INTO tags (body, slug) VALUES (?, ?)", tag.Body, tag.Slug).Error; err != nil {
+		return entity.Tag{}, convertError(err)
+	}
+
+	var found entity.Tag
+	err := r.db.Set("gorm:query_option", "LOCK IN SHARE MODE").Where("slug = ?", tag.Slug).First(&found).Error
+	return found, convertError(err)
+}
+
+func (r gormTagRepository) Save(tag *entity.Tag) error {
+	return convertError(r.db.Save(tag).Error)
+}
+
+func (r gormTagRepository) Delete(id uint) error {
+	return convertError(r.db.Where("id = ?", id).Delete(&entity.Tag{}).Error)
+}
+
+type gormPostTagRepository struct {
+	db *gorm.DB
+}
+
+func (r gormPostTagRepository) Create(postTag *entity.PostTag) error {
+	return convertError(r.db.Create(postTag).Error)
+}
+
+func (r gormPostTagRepository) Delete(postID uint, tagID uint) error {
+	return convertError(r.db.Where("post_id = ?", postID).Where("tag_id = ?", tagID).Delete(&entity.PostTag{}).Error)
+}
+
+func (r gormPostTagRepository) MoveTag(fromTagID uint, toTagID uint) error {
+	// MySQLでは削除対象と同じテーブルを副問い合わせで直接参照できないため、導出表を経由する。
+	err := r.db.Exec(`DELETE FROM post_tags WHERE tag_id = ? AND post_id IN
+		(SELECT post_id FROM (SELECT post_id FROM post_tags WHERE tag_id = ?) AS merged)`, fromTagID, toTagID).Error
+	if err != nil {
+		return convertError(err)
+	}
+
+	return convertError(r.db.Model(&entity.PostTag{}).Where("tag_id = ?", fromTagID).Update("tag_id", toTagID).Error)
+}
+
+type gormPostEventRepository struct {
+	db *gorm.DB
+}
+
+func (r gormPostEventRepository) FindByPostID(postID uint) ([]entity.PostEvent, error) {
+	events := []entity.PostEvent{}
+	err := r.db.Where("post_id = ?", postID).Order("id asc").Find(&events).Error
+	return events, convertError(err)
+}
+
+func (r gormPostEventRepository) Create(event *entity.PostEvent) error {
+	return convertError(r.db.Create(event).Error)
+}
+
+type gormSettlementRepository struct {
+	db *gorm.DB
+}
+
+func (r gormSettlementRepository) FindByPostID(postID uint) ([]entity.Settlement, error) {
+	settlements := []entity.Settlement{}
+	err := r.db.Where("post_id = ?", postID).Order("id asc").Find(&settlements).Error
+	return settlements, convertError(err)
+}
+
+func (r gormSettlementRepository) FindDue(now time.Time) ([]entity.Settlement, error) {
+	var settlements []entity.Settlement
+	err := r.db.
+		Where("status = ?", entity.SettlementPending).
+		Where("next_attempt_at <= ?", now).
+		Order("id asc").
+		Find(&settlements).Error
+	return settlements, convertError(err)
+}
+
+func (r gormSettlementRepository) Claim(id uint, now time.Time, until time.Time) (bool, error) {
+	result := r.db.Model(&entity.Settlement{}).
+		Where("id = ?", id).
+		Where("status = ?", entity.SettlementPending).
+		Where("next_attempt_at <= ?", now).
+		Update("next_attempt_at", until)
+	if result.Error != nil {
+		return false, convertError(result.Error)
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func (r gormSettlementRepository) Create(settlement *entity.Settlement) error {
+	return convertError(r.db.Create(settlement).Error)
+}
+
+func (r gormSettlementRepository) Save(settlement *entity.Settlement) error {
+	return convertError(r.db.Save(settlement).Error)
+}
+
+type gormHoldRepository struct {
+	db *gorm.DB
+}
+
+func (r gormHoldRepository) FindByPostID(postID uint) (entity.Hold, error) {
+	var hold entity.Hold
+	err := r.db.Where("post_id = ?", postID).First(&hold).Error
+	return hold, convertError(err)
+}
+
+func (r gormHoldRepository) FindHeldByUserID(userID uint, excludePostID uint) ([]entity.Hold, error) {
+	var holds []entity.Hold
+	err := r.db.
+		Where("user_id = ?", userID).
+		Where("post_id <> ?", excludePostID).
+		Where("status = ?", entity.HoldHeld).
+		Find(&holds).Error
+	return holds, convertError(err)
+}
+
+func (r gormHoldRepository) Create(hold *entity.Hold) error {
+	return convertError(r.db.Create(hold).Error)
+}
+
+func (r gormHoldRepository) UpdateHeldPoint(postID uint, point int) error {
+	return convertError(r.db.Model(&entity.Hold{}).
+		Where("post_id = ?", postID).
+		Where("status = ?", entity.HoldHeld).
+		Update("point", point).Error)
+}
+
+func (r gormHoldRepository) UpdateHeldStatus(postID uint, status entity.HoldStatus) error {
+	return convertError(r.db.Model(&entity.Hold{}).
+		Where("post_id = ?", postID).
+		Where("status = ?", entity.HoldHeld).
+		Update("status", status).Error)
+}
+
+func (r gormHoldRepository) SetFunded(postID uint) error {
+	return convertError(r.db.Model(&entity.Hold{}).
+		Where("post_id = ?", postID).
+		Update("funded", true).Error)
+}
@@ -0,0 +1,169 @@
+//go:build integration
+// +build integration
+
+package repository
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SeijiOmi/posts-service/db"
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+// MySQLを使用するテスト。DB_USER / DB_PASSWORD / DB_ADDRESS / DB_NAME の接続先のテーブルを空にして実行する。
+// go test -tags integration ./repository
+
+func TestMain(m *testing.M) {
+	db.Init()
+	code := m.Run()
+	db.Close()
+	os.Exit(code)
+}
+
+func newTestGormStore() *gormStore {
+	gdb := db.GetDB()
+	for _, table := range []string{"post_tags", "post_events", "settlements", "holds", "user_locks", "tags", "posts"} {
+		gdb.Exec("DELETE FROM " + table)
+	}
+	return &gormStore{db: gdb}
+}
+
+// assertLocked 他のトランザクションがロックを保持している間、fnがロック待ちで失敗することを確認する。
+// ロック待ちは1秒で打ち切る。
+func assertLocked(t *testing.T, store *gormStore, fn func(tx Store) error) {
+	err := store.Transaction(func(tx Store) error {
+		conn := tx.(*gormStore).db
+		conn.Exec("SET SESSION innodb_lock_wait_timeout = 1")
+		defer conn.Exec("SET SESSION innodb_lock_wait_timeout = DEFAULT")
+		return fn(tx)
+	})
+	assert.NotEqual(t, nil, err)
+}
+
+// holdLock lockでロックを取得したトランザクションを、返却された関数を呼び出すまで保持する。
+func holdLock(t *testing.T, store *gormStore, lock func(tx Store) error) func() {
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := store.Transaction(func(tx Store) error {
+			err := lock(tx)
+			close(locked)
+			if err != nil {
+				return err
+			}
+			<-release
+			return nil
+		})
+		assert.Equal(t, nil, err)
+	}()
+
+	<-locked
+	return func() {
+		close(release)
+		wg.Wait()
+	}
+}
+
+func TestGormTransactionIsolation(t *testing.T) {
+	store := newTestGormStore()
+	inTx := make(chan struct{})
+	checked := make(chan struct{})
+	rollback := errors.New("rollback")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := store.Transaction(func(tx Store) error {
+			post := entity.Post{ID: 1, UserID: 1, Body: "test"}
+			err := tx.Posts().Create(&post)
+			close(inTx)
+			if err != nil {
+				return err
+			}
+			<-checked
+			return rollback
+		})
+		assert.Equal(t, rollback, err)
+	}()
+
+	<-inTx
+	// コミット前の書き込みはトランザクション外から見えない。
+	_, err := store.Posts().FindByID(1)
+	assert.Equal(t, ErrNotFound, err)
+
+	// トランザクション外の書き込みはロールバックの影響を受けない。
+	other := entity.Post{ID: 2, UserID: 2, Body: "test"}
+	assert.Equal(t, nil, store.Posts().Create(&other))
+	close(checked)
+	wg.Wait()
+
+	_, err = store.Posts().FindByID(1)
+	assert.Equal(t, ErrNotFound, err)
+	post, err := store.Posts().FindByID(2)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint(2), post.UserID)
+}
+
+func TestGormLockUser(t *testing.T) {
+	store := newTestGormStore()
+	release := holdLock(t, store, func(tx Store) error { return tx.LockUser(1) })
+
+	assertLocked(t, store, func(tx Store) error { return tx.LockUser(1) })
+	// 他のユーザーのロックは待たない。
+	assert.Equal(t, nil, store.Transaction(func(tx Store) error { return tx.LockUser(2) }))
+
+	release()
+	assert.Equal(t, nil, store.Transaction(func(tx Store) error { return tx.LockUser(1) }))
+}
+
+func TestGormFindByIDForUpdate(t *testing.T) {
+	store := newTestGormStore()
+	post := entity.Post{UserID: 1, Body: "test"}
+	assert.Equal(t, nil, store.Posts().Create(&post))
+
+	release := holdLock(t, store, func(tx Store) error {
+		_, err := tx.Posts().FindByIDForUpdate(post.ID)
+		return err
+	})
+
+	assertLocked(t, store, func(tx Store) error {
+		_, err := tx.Posts().FindByIDForUpdate(post.ID)
+		return err
+	})
+	// ロックしない読み込みは待たない。
+	_, err := store.Posts().FindByID(post.ID)
+	assert.Equal(t, nil, err)
+
+	release()
+}
+
+func TestGormTagCountsSkipDeletedPosts(t *testing.T) {
+	store := newTestGormStore()
+	tag := entity.Tag{Body: "買い物", Slug: "買い物"}
+	assert.Equal(t, nil, store.Tags().Create(&tag))
+	kept := entity.Post{UserID: 1, Body: "test"}
+	deleted := entity.Post{UserID: 1, Body: "test"}
+	assert.Equal(t, nil, store.Posts().Create(&kept))
+	assert.Equal(t, nil, store.Posts().Create(&deleted))
+	assert.Equal(t, nil, store.PostTags().Create(&entity.PostTag{PostID: kept.ID, TagID: tag.ID}))
+	assert.Equal(t, nil, store.PostTags().Create(&entity.PostTag{PostID: deleted.ID, TagID: tag.ID}))
+	assert.Equal(t, nil, store.Posts().Delete(deleted.ID))
+
+	// 削除済みの投稿情報に残った紐づけは数えない。
+	count, err := store.Tags().CountPosts(tag.ID)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, count)
+
+	tags, err := store.Tags().FindAllWithCount()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []entity.TagCount{{Tag: tag, PostCount: 1}}, tags)
+}
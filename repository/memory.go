@@ -0,0 +1,763 @@
+package repository
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+// memoryData メモリ上に保持する全テーブル
+type memoryData struct {
+	posts       map[uint]entity.Post
+	tags        map[uint]entity.Tag
+	postTags    []entity.PostTag
+	events      map[uint]entity.PostEvent
+	settlements map[uint]entity.Settlement
+	holds       map[uint]entity.Hold
+	lastID      map[string]uint
+}
+
+func newMemoryData() *memoryData {
+	return &memoryData{
+		posts:       map[uint]entity.Post{},
+		tags:        map[uint]entity.Tag{},
+		postTags:    []entity.PostTag{},
+		events:      map[uint]entity.PostEvent{},
+		settlements: map[uint]entity.Settlement{},
+		holds:       map[uint]entity.Hold{},
+		lastID:      map[string]uint{},
+	}
+}
+
+// clone ロールバック用の複製を作成する。
+func (d *memoryData) clone() memoryData {
+	c := *newMemoryData()
+	for k, v := range d.posts {
+		c.posts[k] = v
+	}
+	for k, v := range d.tags {
+		c.tags[k] = v
+	}
+	c.postTags = append(c.postTags, d.postTags...)
+	for k, v := range d.events {
+		c.events[k] = v
+	}
+	for k, v := range d.settlements {
+		c.settlements[k] = v
+	}
+	for k, v := range d.holds {
+		c.holds[k] = v
+	}
+	for k, v := range d.lastID {
+		c.lastID[k] = v
+	}
+	return c
+}
+
+// nextID 採番する。指定済みのIDがある場合はそれを使用し、以降の採番をその後ろから行う。
+func (d *memoryData) nextID(table string, id uint) uint {
+	if id == 0 {
+		id = d.lastID[table] + 1
+	}
+	if id > d.lastID[table] {
+		d.lastID[table] = id
+	}
+	return id
+}
+
+// MemoryStore メモリ上にデータを保持するStore。テスト用。
+// トランザクションは書き込みロックを取得して直列に実行し、エラー時は開始時点の状態に戻す。
+type MemoryStore struct {
+	mu   *sync.RWMutex
+	data *memoryData
+	inTx bool
+}
+
+// NewMemoryStore 空のMemoryStoreを生成する。
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{mu: &sync.RWMutex{}, data: newMemoryData()}
+}
+
+// Reset 全てのデータを削除する。
+func (s *MemoryStore) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*s.data = *newMemoryData()
+}
+
+// Posts 投稿情報のリポジトリを取得する。
+func (s *MemoryStore) Posts() PostRepository { return memoryPostRepository{s} }
+
+// Tags タグ情報のリポジトリを取得する。
+func (s *MemoryStore) Tags() TagRepository { return memoryTagRepository{s} }
+
+// PostTags 投稿情報とタグの紐づけのリポジトリを取得する。
+func (s *MemoryStore) PostTags() PostTagRepository { return memoryPostTagRepository{s} }
+
+// PostEvents 状態遷移履歴のリポジトリを取得する。
+func (s *MemoryStore) PostEvents() PostEventRepository { return memoryPostEventRepository{s} }
+
+// Settlements ポイント精算のリポジトリを取得する。
+func (s *MemoryStore) Settlements() SettlementRepository { return memorySettlementRepository{s} }
+
+// Holds エスクローのリポジトリを取得する。
+func (s *MemoryStore) Holds() HoldRepository { return memoryHoldRepository{s} }
+
+// LockUser トランザクションは直列に実行されるため何もしない。
+func (s *MemoryStore) LockUser(userID uint) error {
+	return nil
+}
+
+// Transaction fnを書き込みロックを取得した状態で実行する。
+func (s *MemoryStore) Transaction(fn func(Store) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.data.clone()
+	tx := &MemoryStore{mu: s.mu, data: s.data, inTx: true}
+
+	committed := false
+	defer func() {
+		if !committed {
+			*s.data = snapshot
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	committed = true
+	return nil
+}
+
+func (s *MemoryStore) read(fn func(d *memoryData)) {
+	if !s.inTx {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+	}
+	fn(s.data)
+}
+
+func (s *MemoryStore) write(fn func(d *memoryData) error) error {
+	if !s.inTx {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+	return fn(s.data)
+}
+
+// sortPageMemory 並べ替えて取得範囲を適用する。SortRelevanceの場合はscoresの高い順とする。
+func sortPageMemory(posts []entity.Post, sortBy Sort, scores map[uint]float64, page Page) []entity.Post {
+	if sortBy == SortRelevance && scores == nil {
+		sortBy = SortNewest
+	}
+
+	var less func(a, b entity.Post) bool
+	switch sortBy {
+	case SortRelevance:
+		less = func(a, b entity.Post) bool {
+			if scores[a.ID] != scores[b.ID] {
+				return scores[a.ID] > scores[b.ID]
+			}
+			return a.ID > b.ID
+		}
+	case SortOldest:
+		less = func(a, b entity.Post) bool { return a.ID < b.ID }
+	case SortPoint:
+		less = func(a, b entity.Post) bool {
+			if a.Point != b.Point {
+				return a.Point > b.Point
+			}
+			return a.ID > b.ID
+		}
+	default:
+		less = func(a, b entity.Post) bool { return a.ID > b.ID }
+	}
+
+	sort.Slice(posts, func(i, j int) bool { return less(posts[i], posts[j]) })
+	if page.After != nil && sortBy != SortRelevance {
+		after := entity.Post{ID: page.After.ID, Point: page.After.Point}
+		n := sort.Search(len(posts), func(i int) bool { return less(after, posts[i]) })
+		posts = posts[n:]
+	}
+	if page.Offset >= len(posts) {
+		return []entity.Post{}
+	}
+	posts = posts[page.Offset:]
+	if page.Limit > 0 && page.Limit < len(posts) {
+		posts = posts[:page.Limit]
+	}
+	return posts
+}
+
+// matchPost タグ以外の絞り込み条件に一致するか判定する。
+func matchPost(f PostFilter, post entity.Post) bool {
+	if len(f.Statuses) > 0 && !containsStatus(f.Statuses, post.Status) {
+		return false
+	}
+	switch {
+	case f.MinPoint != nil && post.Point < *f.MinPoint,
+		f.MaxPoint != nil && post.Point > *f.MaxPoint,
+		f.UserID != nil && post.UserID != *f.UserID,
+		f.HelperUserID != nil && post.HelperUserID != *f.HelperUserID,
+		f.CreatedFrom != nil && post.CreatedAt.Before(*f.CreatedFrom),
+		f.CreatedBefore != nil && !post.CreatedAt.Before(*f.CreatedBefore):
+		return false
+	}
+	return true
+}
+
+func containsStatus(statuses []entity.Status, status entity.Status) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+type memoryPostRepository struct {
+	s *MemoryStore
+}
+
+func (r memoryPostRepository) Find(filter PostFilter, page Page) ([]entity.Post, error) {
+	tagIDs := filter.distinctTagIDs()
+
+	var posts []entity.Post
+	var scores map[uint]float64
+	r.s.read(func(d *memoryData) {
+		if filter.Text != "" {
+			scores = scoreBodies(filter.Text, d.posts)
+		}
+
+		wanted := map[uint]bool{}
+		for _, id := range tagIDs {
+			wanted[id] = true
+		}
+		// 同じタグが重複して紐づいていても1件と数える。
+		found := map[uint]map[uint]bool{}
+		for _, postTag := range d.postTags {
+			if !wanted[postTag.TagID] {
+				continue
+			}
+			if found[postTag.PostID] == nil {
+				found[postTag.PostID] = map[uint]bool{}
+			}
+			found[postTag.PostID][postTag.TagID] = true
+		}
+
+		for _, post := range d.posts {
+			switch {
+			case !matchPost(filter, post):
+				continue
+			case scores != nil && scores[post.ID] == 0:
+				continue
+			case len(tagIDs) > 0 && filter.AllTags && len(found[post.ID]) < len(tagIDs):
+				continue
+			case len(tagIDs) > 0 && len(found[post.ID]) == 0:
+				continue
+			}
+			posts = append(posts, post)
+		}
+	})
+	return sortPageMemory(posts, filter.Sort, scores, page), nil
+}
+
+// scoreBodies 全ての投稿情報の本文とtextの関連度を計算する。
+func scoreBodies(text string, posts map[uint]entity.Post) map[uint]float64 {
+	bodies := make([]string, 0, len(posts))
+	for _, post := range posts {
+		bodies = append(bodies, post.Body)
+	}
+
+	scorer := newRelevanceScorer(text, bodies)
+	scores := map[uint]float64{}
+	for id, post := range posts {
+		scores[id] = scorer.score(post.Body)
+	}
+	return scores
+}
+
+func (r memoryPostRepository) FindByID(id uint) (entity.Post, error) {
+	var post entity.Post
+	var ok bool
+	r.s.read(func(d *memoryData) {
+		post, ok = d.posts[id]
+	})
+	if !ok {
+		return entity.Post{}, ErrNotFound
+	}
+	return post, nil
+}
+
+// FindByIDForUpdate トランザクションは直列に実行されるため、FindByIDと同じ。
+func (r memoryPostRepository) FindByIDForUpdate(id uint) (entity.Post, error) {
+	return r.FindByID(id)
+}
+
+func (r memoryPostRepository) Create(post *entity.Post) error {
+	return r.s.write(func(d *memoryData) error {
+		if _, ok := d.posts[post.ID]; ok && post.ID != 0 {
+			return ErrDuplicate
+		}
+		post.ID = d.nextID("posts", post.ID)
+		if post.CreatedAt.IsZero() {
+			post.CreatedAt = time.Now()
+		}
+		d.posts[post.ID] = *post
+		return nil
+	})
+}
+
+func (r memoryPostRepository) Save(post *entity.Post) error {
+	if post.ID == 0 {
+		return r.Create(post)
+	}
+	return r.s.write(func(d *memoryData) error {
+		d.posts[post.ID] = *post
+		d.nextID("posts", post.ID)
+		return nil
+	})
+}
+
+func (r memoryPostRepository) Delete(id uint) error {
+	return r.s.write(func(d *memoryData) error {
+		delete(d.posts, id)
+		return nil
+	})
+}
+
+type memoryTagRepository struct {
+	s *MemoryStore
+}
+
+func (r memoryTagRepository) FindBySlug(slug string) (entity.Tag, error) {
+	tag := entity.Tag{}
+	r.s.read(func(d *memoryData) {
+		for _, t := range d.tags {
+			if t.Slug == slug && (tag.ID == 0 || t.ID < tag.ID) {
+				tag = t
+			}
+		}
+	})
+	if tag.ID == 0 {
+		return entity.Tag{}, ErrNotFound
+	}
+	return tag, nil
+}
+
+func (r memoryTagRepository) FindLikeSlug(slug string) ([]entity.Tag, error) {
+	var tags []entity.Tag
+	r.s.read(func(d *memoryData) {
+		for _, tag := range d.tags {
+			if strings.Contains(tag.Slug, slug) {
+				tags = append(tags, tag)
+			}
+		}
+	})
+	sort.Slice(tags, func(i, j int) bool { return tags[i].ID < tags[j].ID })
+	return tags, nil
+}
+
+func (r memoryTagRepository) FindByPostID(postID uint) ([]entity.Tag, error) {
+	var tags []entity.Tag
+	r.s.read(func(d *memoryData) {
+		for _, postTag := range d.postTags {
+			if tag, ok := d.tags[postTag.TagID]; ok && postTag.PostID == postID {
+				tags = append(tags, tag)
+			}
+		}
+	})
+	return tags, nil
+}
+
+func (r memoryTagRepository) FindByPostIDs(postIDs []uint) (map[uint][]entity.Tag, error) {
+	wanted := map[uint]bool{}
+	for _, id := range postIDs {
+		wanted[id] = true
+	}
+
+	tags := map[uint][]entity.Tag{}
+	r.s.read(func(d *memoryData) {
+		for _, postTag := range d.postTags {
+			if tag, ok := d.tags[postTag.TagID]; ok && wanted[postTag.PostID] {
+				tags[postTag.PostID] = append(tags[postTag.PostID], tag)
+			}
+		}
+	})
+	return tags, nil
+}
+
+func (r memoryTagRepository) FindByID(id uint) (entity.Tag, error) {
+	var tag entity.Tag
+	var ok bool
+	r.s.read(func(d *memoryData) {
+		tag, ok = d.tags[id]
+	})
+	if !ok {
+		return entity.Tag{}, ErrNotFound
+	}
+	return tag, nil
+}
+
+func (r memoryTagRepository) FindAllWithCount() ([]entity.TagCount, error) {
+	tags := []entity.TagCount{}
+	r.s.read(func(d *memoryData) {
+		for _, tag := range d.tags {
+			tags = append(tags, entity.TagCount{Tag: tag, PostCount: countPosts(d, tag.ID)})
+		}
+	})
+	sort.Slice(tags, func(i, j int) bool { return tags[i].ID < tags[j].ID })
+	return tags, nil
+}
+
+func (r memoryTagRepository) FindTrending(since time.Time, statuses []entity.Status, limit int) ([]entity.TagCount, error) {
+	filter := PostFilter{Statuses: statuses, CreatedFrom: &since}
+	tags := []entity.TagCount{}
+	r.s.read(func(d *memoryData) {
+		posts := map[uint]map[uint]bool{}
+		for _, postTag := range d.postTags {
+			post, ok := d.posts[postTag.PostID]
+			if !ok || !matchPost(filter, post) {
+				continue
+			}
+			if posts[postTag.TagID] == nil {
+				posts[postTag.TagID] = map[uint]bool{}
+			}
+			posts[postTag.TagID][post.ID] = true
+		}
+
+		for tagID, tagPosts := range posts {
+			if tag, ok := d.tags[tagID]; ok {
+				tags = append(tags, entity.TagCount{Tag: tag, PostCount: len(tagPosts)})
+			}
+		}
+	})
+
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].PostCount != tags[j].PostCount {
+			return tags[i].PostCount > tags[j].PostCount
+		}
+		return tags[i].ID < tags[j].ID
+	})
+	if limit > 0 && limit < len(tags) {
+		tags = tags[:limit]
+	}
+	return tags, nil
+}
+
+func (r memoryTagRepository) CountPosts(tagID uint) (int, error) {
+	var count int
+	r.s.read(func(d *memoryData) {
+		count = countPosts(d, tagID)
+	})
+	return count, nil
+}
+
+// countPosts タグが付いた投稿情報の件数を数える。同じ投稿情報の重複した紐づけは1件と数える。
+// 削除済みの投稿情報の紐づけは数えない。
+func countPosts(d *memoryData, tagID uint) int {
+	posts := map[uint]bool{}
+	for _, postTag := range d.postTags {
+		if _, ok := d.posts[postTag.PostID]; !ok {
+			continue
+		}
+		if postTag.TagID == tagID {
+			posts[postTag.PostID] = true
+		}
+	}
+	return len(posts)
+}
+
+// duplicateTag Slugが他のタグで登録済みか判定する。
+// slug導入前のタグ(MySQLではNULL)を再現するため、空のSlugは重複としない。
+func duplicateTag(d *memoryData, tag entity.Tag) bool {
+	if tag.Slug == "" {
+		return false
+	}
+	for _, t := range d.tags {
+		if t.Slug == tag.Slug && t.ID != tag.ID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r memoryTagRepository) Create(tag *entity.Tag) error {
+	return r.s.write(func(d *memoryData) error {
+		if _, ok := d.tags[tag.ID]; ok && tag.ID != 0 {
+			return ErrDuplicate
+		}
+		if duplicateTag(d, *tag) {
+			return ErrDuplicate
+		}
+		tag.ID = d.nextID("tags", tag.ID)
+		d.tags[tag.ID] = *tag
+		return nil
+	})
+}
+
+func (r memoryTagRepository) FindOrCreate(tag entity.Tag) (entity.Tag, error) {
+	var found entity.Tag
+	err := r.s.write(func(d *memoryData) error {
+		for _, t := range d.tags {
+			if t.Slug == tag.Slug {
+				found = t
+				return nil
+			}
+		}
+		found = tag
+		found.ID = d.nextID("tags", 0)
+		d.tags[found.ID] = found
+		return nil
+	})
+	return found, err
+}
+
+func (r memoryTagRepository) Save(tag *entity.Tag) error {
+	if tag.ID == 0 {
+		return r.Create(tag)
+	}
+	return r.s.write(func(d *memoryData) error {
+		if duplicateTag(d, *tag) {
+			return ErrDuplicate
+		}
+		d.tags[tag.ID] = *tag
+		d.nextID("tags", tag.ID)
+		return nil
+	})
+}
+
+func (r memoryTagRepository) Delete(id uint) error {
+	return r.s.write(func(d *memoryData) error {
+		delete(d.tags, id)
+		return nil
+	})
+}
+
+type memoryPostTagRepository struct {
+	s *MemoryStore
+}
+
+func (r memoryPostTagRepository) Create(postTag *entity.PostTag) error {
+	return r.s.write(func(d *memoryData) error {
+		d.postTags = append(d.postTags, *postTag)
+		return nil
+	})
+}
+
+func (r memoryPostTagRepository) Delete(postID uint, tagID uint) error {
+	return r.s.write(func(d *memoryData) error {
+		postTags := []entity.PostTag{}
+		for _, postTag := range d.postTags {
+			if postTag.PostID != postID || postTag.TagID != tagID {
+				postTags = append(postTags, postTag)
+			}
+		}
+		d.postTags = postTags
+		return nil
+	})
+}
+
+func (r memoryPostTagRepository) MoveTag(fromTagID uint, toTagID uint) error {
+	return r.s.write(func(d *memoryData) error {
+		tagged := map[uint]bool{}
+		for _, postTag := range d.postTags {
+			if postTag.TagID == toTagID {
+				tagged[postTag.PostID] = true
+			}
+		}
+
+		postTags := []entity.PostTag{}
+		for _, postTag := range d.postTags {
+			if postTag.TagID == fromTagID {
+				if tagged[postTag.PostID] {
+					continue
+				}
+				postTag.TagID = toTagID
+			}
+			postTags = append(postTags, postTag)
+		}
+		d.postTags = postTags
+		return nil
+	})
+}
+
+type memoryPostEventRepository struct {
+	s *MemoryStore
+}
+
+func (r memoryPostEventRepository) FindByPostID(postID uint) ([]entity.PostEvent, error) {
+	events := []entity.PostEvent{}
+	r.s.read(func(d *memoryData) {
+		for _, event := range d.events {
+			if event.PostID == postID {
+				events = append(events, event)
+			}
+		}
+	})
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+func (r memoryPostEventRepository) Create(event *entity.PostEvent) error {
+	return r.s.write(func(d *memoryData) error {
+		event.ID = d.nextID("post_events", event.ID)
+		if event.CreatedAt.IsZero() {
+			event.CreatedAt = time.Now()
+		}
+		d.events[event.ID] = *event
+		return nil
+	})
+}
+
+type memorySettlementRepository struct {
+	s *MemoryStore
+}
+
+func (r memorySettlementRepository) FindByPostID(postID uint) ([]entity.Settlement, error) {
+	settlements := []entity.Settlement{}
+	r.s.read(func(d *memoryData) {
+		for _, settlement := range d.settlements {
+			if settlement.PostID == postID {
+				settlements = append(settlements, settlement)
+			}
+		}
+	})
+	sort.Slice(settlements, func(i, j int) bool { return settlements[i].ID < settlements[j].ID })
+	return settlements, nil
+}
+
+func (r memorySettlementRepository) FindDue(now time.Time) ([]entity.Settlement, error) {
+	var settlements []entity.Settlement
+	r.s.read(func(d *memoryData) {
+		for _, settlement := range d.settlements {
+			if settlement.Status == entity.SettlementPending && !settlement.NextAttemptAt.After(now) {
+				settlements = append(settlements, settlement)
+			}
+		}
+	})
+	sort.Slice(settlements, func(i, j int) bool { return settlements[i].ID < settlements[j].ID })
+	return settlements, nil
+}
+
+func (r memorySettlementRepository) Claim(id uint, now time.Time, until time.Time) (bool, error) {
+	claimed := false
+	err := r.s.write(func(d *memoryData) error {
+		settlement, ok := d.settlements[id]
+		if !ok || settlement.Status != entity.SettlementPending || settlement.NextAttemptAt.After(now) {
+			return nil
+		}
+		settlement.NextAttemptAt = until
+		d.settlements[id] = settlement
+		claimed = true
+		return nil
+	})
+	return claimed, err
+}
+
+func (r memorySettlementRepository) Create(settlement *entity.Settlement) error {
+	return r.s.write(func(d *memoryData) error {
+		for _, s := range d.settlements {
+			if s.IdempotencyKey == settlement.IdempotencyKey {
+				return ErrDuplicate
+			}
+		}
+		settlement.ID = d.nextID("settlements", settlement.ID)
+		now := time.Now()
+		settlement.CreatedAt = now
+		settlement.UpdatedAt = now
+		d.settlements[settlement.ID] = *settlement
+		return nil
+	})
+}
+
+func (r memorySettlementRepository) Save(settlement *entity.Settlement) error {
+	return r.s.write(func(d *memoryData) error {
+		settlement.UpdatedAt = time.Now()
+		d.settlements[settlement.ID] = *settlement
+		return nil
+	})
+}
+
+type memoryHoldRepository struct {
+	s *MemoryStore
+}
+
+func (r memoryHoldRepository) FindByPostID(postID uint) (entity.Hold, error) {
+	hold := entity.Hold{}
+	r.s.read(func(d *memoryData) {
+		for _, h := range d.holds {
+			if h.PostID == postID {
+				hold = h
+			}
+		}
+	})
+	if hold.ID == 0 {
+		return entity.Hold{}, ErrNotFound
+	}
+	return hold, nil
+}
+
+func (r memoryHoldRepository) FindHeldByUserID(userID uint, excludePostID uint) ([]entity.Hold, error) {
+	var holds []entity.Hold
+	r.s.read(func(d *memoryData) {
+		for _, hold := range d.holds {
+			if hold.UserID == userID && hold.PostID != excludePostID && hold.Status == entity.HoldHeld {
+				holds = append(holds, hold)
+			}
+		}
+	})
+	return holds, nil
+}
+
+func (r memoryHoldRepository) Create(hold *entity.Hold) error {
+	return r.s.write(func(d *memoryData) error {
+		for _, h := range d.holds {
+			if h.PostID == hold.PostID {
+				return ErrDuplicate
+			}
+		}
+		hold.ID = d.nextID("holds", hold.ID)
+		now := time.Now()
+		hold.CreatedAt = now
+		hold.UpdatedAt = now
+		d.holds[hold.ID] = *hold
+		return nil
+	})
+}
+
+// updateHold postIDのエスクローのうち条件に合うものを更新する。
+func (r memoryHoldRepository) updateHold(postID uint, heldOnly bool, update func(hold *entity.Hold)) error {
+	return r.s.write(func(d *memoryData) error {
+		for id, hold := range d.holds {
+			if hold.PostID != postID || (heldOnly && hold.Status != entity.HoldHeld) {
+				continue
+			}
+			update(&hold)
+			hold.UpdatedAt = time.Now()
+			d.holds[id] = hold
+		}
+		return nil
+	})
+}
+
+func (r memoryHoldRepository) UpdateHeldPoint(postID uint, point int) error {
+	return r.updateHold(postID, true, func(hold *entity.Hold) { hold.Point = point })
+}
+
+func (r memoryHoldRepository) UpdateHeldStatus(postID uint, status entity.HoldStatus) error {
+	return r.updateHold(postID, true, func(hold *entity.Hold) { hold.Status = status })
+}
+
+func (r memoryHoldRepository) SetFunded(postID uint) error {
+	return r.updateHold(postID, false, func(hold *entity.Hold) { hold.Funded = true })
+}
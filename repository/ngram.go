@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// ngramSize MySQLのngram_token_sizeの既定値に合わせたN-gramの文字数
+const ngramSize = 2
+
+// ngrams 空白で区切った語ごとにN-gramに分割する。ngramSizeより短い語はそのまま1つのN-gramとする。
+func ngrams(text string) []string {
+	var grams []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), unicode.IsSpace) {
+		runes := []rune(word)
+		if len(runes) < ngramSize {
+			grams = append(grams, word)
+			continue
+		}
+		for i := 0; i+ngramSize <= len(runes); i++ {
+			grams = append(grams, string(runes[i:i+ngramSize]))
+		}
+	}
+	return grams
+}
+
+// relevanceScorer MySQLのFULLTEXT(NATURAL LANGUAGE MODE)を模した関連度の計算。
+// 検索語のN-gramごとに、本文中の出現回数と全体での珍しさ(IDF)を掛け合わせて合計する。
+type relevanceScorer struct {
+	grams []string
+	idf   map[string]float64
+}
+
+func newRelevanceScorer(text string, bodies []string) relevanceScorer {
+	scorer := relevanceScorer{idf: map[string]float64{}}
+	seen := map[string]bool{}
+	for _, gram := range ngrams(text) {
+		if !seen[gram] {
+			seen[gram] = true
+			scorer.grams = append(scorer.grams, gram)
+		}
+	}
+
+	df := map[string]int{}
+	for _, body := range bodies {
+		counted := map[string]bool{}
+		for _, gram := range ngrams(body) {
+			if seen[gram] && !counted[gram] {
+				counted[gram] = true
+				df[gram]++
+			}
+		}
+	}
+	for _, gram := range scorer.grams {
+		scorer.idf[gram] = math.Log(1 + float64(len(bodies)+1)/float64(df[gram]+1))
+	}
+	return scorer
+}
+
+// score 本文の関連度を計算する。検索語のN-gramを1つも含まない場合は0とする。
+func (s relevanceScorer) score(body string) float64 {
+	tf := map[string]int{}
+	for _, gram := range ngrams(body) {
+		tf[gram]++
+	}
+
+	var score float64
+	for _, gram := range s.grams {
+		score += float64(tf[gram]) * s.idf[gram]
+	}
+	return score
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+var (
+	// ErrNotFound 対象のデータが存在しない。
+	ErrNotFound = errors.New("record not found")
+	// ErrDuplicate 一意であるべき値が既に登録されている。
+	ErrDuplicate = errors.New("duplicate entry")
+)
+
+// Store 永続化処理の入口
+type Store interface {
+	Posts() PostRepository
+	Tags() TagRepository
+	PostTags() PostTagRepository
+	PostEvents() PostEventRepository
+	Settlements() SettlementRepository
+	Holds() HoldRepository
+
+	// LockUser ユーザー単位の処理をトランザクション終了まで直列化する。Transaction内で呼び出すこと。
+	LockUser(userID uint) error
+	// Transaction fnをトランザクション内で実行する。fnに渡されるStoreはそのトランザクションに束縛される。
+	// fnがエラーを返却した場合はロールバックする。
+	Transaction(fn func(Store) error) error
+}
+
+// Page 投稿情報一覧の取得範囲
+type Page struct {
+	// After nil以外の場合、並び順でこの位置より後ろの投稿情報のみ取得する。
+	After  *PostKey
+	Offset int
+	Limit  int
+}
+
+// PostKey 並び順における投稿情報の位置
+type PostKey struct {
+	ID uint
+	// Point SortPointの場合のみ使用する。
+	Point uint
+}
+
+// PostRepository 投稿情報の永続化
+type PostRepository interface {
+	// Find 条件に一致する投稿情報をfilter.Sortの順に取得する。
+	Find(filter PostFilter, page Page) ([]entity.Post, error)
+	FindByID(id uint) (entity.Post, error)
+	// FindByIDForUpdate 投稿情報を行ロックして取得する。ロックはトランザクション終了時に解放される。
+	// Transaction内で呼び出すこと。
+	FindByIDForUpdate(id uint) (entity.Post, error)
+	Create(post *entity.Post) error
+	Save(post *entity.Post) error
+	Delete(id uint) error
+}
+
+// TagRepository タグ情報の永続化
+type TagRepository interface {
+	FindBySlug(slug string) (entity.Tag, error)
+	// FindLikeSlug Slugに指定された文字列を含むタグを取得する。
+	FindLikeSlug(slug string) ([]entity.Tag, error)
+	// FindByPostID 投稿情報に付いたタグを取得する。
+	FindByPostID(postID uint) ([]entity.Tag, error)
+	// FindByPostIDs 複数の投稿情報に付いたタグを1回の問い合わせで取得し、投稿IDごとにまとめる。
+	FindByPostIDs(postIDs []uint) (map[uint][]entity.Tag, error)
+	FindByID(id uint) (entity.Tag, error)
+	// FindAllWithCount 全てのタグを投稿情報の件数とともにID順に取得する。
+	FindAllWithCount() ([]entity.TagCount, error)
+	// FindTrending since以降に作成された投稿情報の件数が多い順にタグを取得する。
+	// statusesを指定した場合は、いずれかの状態の投稿情報のみ数える。
+	FindTrending(since time.Time, statuses []entity.Status, limit int) ([]entity.TagCount, error)
+	// CountPosts タグが付いた投稿情報の件数を取得する。
+	CountPosts(tagID uint) (int, error)
+	// Create Slugが登録済みの場合はErrDuplicateを返却する。
+	Create(tag *entity.Tag) error
+	// FindOrCreate tag.Slugのタグを取得する。無い場合はtagを作成する。
+	// 同じSlugを同時に作成しても1件のみ作成され、どちらも同じタグを取得する。Transaction内で呼び出すこと。
+	FindOrCreate(tag entity.Tag) (entity.Tag, error)
+	// Save Slugが他のタグで登録済みの場合はErrDuplicateを返却する。
+	Save(tag *entity.Tag) error
+	Delete(id uint) error
+}
+
+// PostTagRepository 投稿情報とタグの紐づけの永続化
+type PostTagRepository interface {
+	Create(postTag *entity.PostTag) error
+	// Delete 投稿情報からタグの紐づけを外す。
+	Delete(postID uint, tagID uint) error
+	// MoveTag fromTagIDの紐づけをtoTagIDに付け替える。既にtoTagIDが付いた投稿情報の紐づけは削除する。
+	MoveTag(fromTagID uint, toTagID uint) error
+}
+
+// PostEventRepository 投稿情報の状態遷移履歴の永続化
+type PostEventRepository interface {
+	// FindByPostID 投稿情報の状態遷移履歴を古い順に取得する。
+	FindByPostID(postID uint) ([]entity.PostEvent, error)
+	Create(event *entity.PostEvent) error
+}
+
+// SettlementRepository ポイント精算の永続化
+type SettlementRepository interface {
+	// FindByPostID 投稿情報のポイント精算を古い順に取得する。
+	FindByPostID(postID uint) ([]entity.Settlement, error)
+	// FindDue 配信時刻を過ぎた未配信のポイント精算を古い順に取得する。
+	FindDue(now time.Time) ([]entity.Settlement, error)
+	// Claim 配信時刻を過ぎた未配信のポイント精算の配信時刻をuntilまで先送りし、配信権を取得する。
+	// 他で配信権を取得済みの場合はfalseを返却する。
+	Claim(id uint, now time.Time, until time.Time) (bool, error)
+	// Create 冪等キーが登録済みの場合はErrDuplicateを返却する。
+	Create(settlement *entity.Settlement) error
+	Save(settlement *entity.Settlement) error
+}
+
+// HoldRepository エスクローの永続化
+type HoldRepository interface {
+	FindByPostID(postID uint) (entity.Hold, error)
+	// FindHeldByUserID ユーザーの確保中のエスクローを取得する。excludePostIDの投稿は除外する。
+	FindHeldByUserID(userID uint, excludePostID uint) ([]entity.Hold, error)
+	Create(hold *entity.Hold) error
+	// UpdateHeldPoint 確保中のエスクローのポイントを更新する。
+	UpdateHeldPoint(postID uint, point int) error
+	// UpdateHeldStatus 確保中のエスクローの状態を更新する。
+	UpdateHeldStatus(postID uint, status entity.HoldStatus) error
+	SetFunded(postID uint) error
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/SeijiOmi/posts-service/client"
+	"github.com/SeijiOmi/posts-service/controller"
+	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/SeijiOmi/posts-service/service"
+	"github.com/gin-gonic/gin"
+)
+
+const bearerPrefix = "Bearer "
+
+// authRequired リクエストユーザーを認証し、gin.Contextに格納するミドルウェア
+// Authorization: Bearer ヘッダーを優先し、無い場合は移行期間としてJSONボディのtokenを使用する。
+func authRequired(b service.Behavior) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c)
+		if token == "" {
+			token = bodyToken(c)
+			if token != "" {
+				c.Header("Deprecation", "true")
+				c.Header("Warning", `299 - "token in request body is deprecated, use Authorization: Bearer"`)
+			}
+		}
+
+		user, err := b.Authenticate(c.Request.Context(), token)
+		if errors.Is(err, client.ErrInvalidToken) {
+			fmt.Println(err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		// ユーザーサービスの障害時はトークンを無効と判断できないため、401にはしない。
+		if err != nil {
+			fmt.Println(err)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "auth_unavailable"})
+			return
+		}
+
+		c.Set(controller.AuthUserKey, user)
+		c.Next()
+	}
+}
+
+// adminRequired authRequiredで認証したユーザーが管理者でない場合は403とするミドルウェア
+func adminRequired(b service.Behavior) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(controller.AuthUserKey).(entity.AuthUser)
+		if !b.IsAdmin(user) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden", "reason": "not_admin"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if !strings.HasPrefix(header, bearerPrefix) {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, bearerPrefix))
+}
+
+// bodyToken JSONボディからtokenを取得する。ボディは後続の処理のために元に戻す。
+func bodyToken(c *gin.Context) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+	buf, err := ioutil.ReadAll(c.Request.Body)
+	c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(buf))
+	if err != nil {
+		return ""
+	}
+
+	var request struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(buf, &request); err != nil {
+		return ""
+	}
+	return request.Token
+}
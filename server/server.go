@@ -1,18 +1,47 @@
 package server
 
 import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"os"
+
 	"github.com/SeijiOmi/posts-service/controller"
+	"github.com/SeijiOmi/posts-service/service"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
+// defaultDebugAddr 確認用エンドポイントの待ち受けアドレスの既定値
+const defaultDebugAddr = "127.0.0.1:8091"
+
 // Init サーバー起動
-func Init() {
-	r := router()
+// 確認用エンドポイントはAPIとは別に、環境変数DEBUG_ADDRのアドレスで待ち受ける。
+func Init(b service.Behavior) {
+	debugAddr := os.Getenv("DEBUG_ADDR")
+	if debugAddr == "" {
+		debugAddr = defaultDebugAddr
+	}
+	go func() {
+		if err := http.ListenAndServe(debugAddr, debugHandler()); err != nil {
+			fmt.Println(err)
+		}
+	}()
+
+	r := router(b)
 	r.Run(":8090")
 }
 
-func router() *gin.Engine {
+// debugHandler ユーザー情報キャッシュのヒット数などの確認用。
+// expvarはコマンドライン引数やメモリ状況も公開するため、外部に公開しないアドレスで待ち受けること。
+func debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+func router(b service.Behavior) *gin.Engine {
+	controller.Init(b)
 	r := gin.Default()
 
 	// https://godoc.org/github.com/gin-gonic/gin#RouterGroup.Use
@@ -33,6 +62,7 @@ func router() *gin.Engine {
 			"X-Csrftoken",
 			"Content-Type",
 			"Accept",
+			"Authorization",
 		},
 		// 許可したいアクセス元の一覧
 		AllowOrigins: []string{
@@ -40,13 +70,18 @@ func router() *gin.Engine {
 		},
 	}))
 
+	auth := authRequired(b)
+	admin := adminRequired(b)
+
 	p := r.Group("/posts")
 	{
 		p.GET("", controller.Index)
 		p.GET("/:id", controller.Show)
-		p.POST("", controller.Create)
-		p.PUT("/:id", controller.Update)
-		p.DELETE("/:id", controller.Delete)
+		p.GET("/:id/history", controller.History)
+		p.GET("/:id/settlements", controller.Settlements)
+		p.POST("", auth, controller.Create)
+		p.PUT("/:id", auth, controller.Update)
+		p.DELETE("/:id", auth, controller.Delete)
 	}
 
 	u := r.Group("/user")
@@ -57,14 +92,14 @@ func router() *gin.Engine {
 	h := r.Group("/helper")
 	{
 		h.GET("/:id", controller.HelperShow)
-		h.POST("", controller.SetHelpUser)
-		h.DELETE("/:id", controller.TakeHelpUser)
+		h.POST("", auth, controller.SetHelpUser)
+		h.DELETE("/:id", auth, controller.TakeHelpUser)
 	}
 
 	d := r.Group("/done")
 	{
-		d.POST("", controller.DonePayment)
-		d.PUT("/:id", controller.DoneAcceptance)
+		d.POST("", auth, controller.DonePayment)
+		d.PUT("/:id", auth, controller.DoneAcceptance)
 	}
 
 	a := r.Group("/amount")
@@ -82,5 +117,15 @@ func router() *gin.Engine {
 		i.GET("/:id", controller.TagShow)
 	}
 
+	ts := r.Group("/tags")
+	{
+		ts.GET("", controller.TagIndex)
+		ts.GET("/trending", controller.TagTrending)
+		ts.GET("/suggest", controller.TagSuggest)
+		ts.PUT("/:id", auth, admin, controller.TagRename)
+		ts.POST("/:id/merge", auth, admin, controller.TagMerge)
+		ts.DELETE("/:id", auth, admin, controller.TagDelete)
+	}
+
 	return r
 }
@@ -3,6 +3,7 @@ package server
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -10,18 +11,32 @@ import (
 	"strconv"
 	"testing"
 
-	"github.com/SeijiOmi/posts-service/db"
+	"github.com/SeijiOmi/posts-service/client"
 	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/SeijiOmi/posts-service/repository"
+	"github.com/SeijiOmi/posts-service/service"
 	"github.com/jmcvetta/napping"
 	"github.com/stretchr/testify/assert"
 )
 
-var client = new(http.Client)
+var httpClient = new(http.Client)
 var testServer *httptest.Server
 var postDefault = entity.Post{Body: "test", Point: 100}
-var tagDefault = entity.Tag{Body: "test"}
-var tmpBaseUserURL string
-var tmpBasePointURL string
+var tagDefault = entity.Tag{Body: "test", Slug: "test"}
+var testStore = repository.NewMemoryStore()
+var testBehavior service.Behavior
+
+// testUsers 認証はテスト用トークンのみ、ユーザーID:1として扱う。
+var testUsers = &client.FakeUserDirectory{
+	Users: map[int]entity.User{
+		1: {ID: 1, Name: "taro"},
+		2: {ID: 2, Name: "yamada"},
+		3: {ID: 3, Name: "itoko"},
+		4: {ID: 4, Name: "domi"},
+		5: {ID: 5, Name: "dami"},
+	},
+	Tokens: map[string]int{"testToken": 1, "tests": 1, "helperToken": 2},
+}
 
 func TestMain(m *testing.M) {
 	setup()
@@ -31,21 +46,17 @@ func TestMain(m *testing.M) {
 }
 
 func setup() {
-	tmpBaseUserURL = os.Getenv("USER_URL")
-	tmpBasePointURL = os.Getenv("POINT_URL")
-	os.Setenv("USER_URL", "http://post-mock-user:3000")
-	os.Setenv("POINT_URL", "http://post-mock-point:3000")
-	db.Init()
-	router := router()
+	// 保有ポイントは全ユーザー1000とする。
+	points := &client.FakePointLedger{DefaultTotal: 1000}
+	testBehavior = service.NewBehavior(testStore, testUsers, points)
+	// 管理者はユーザーID:1のみとする。
+	testBehavior.AdminUserIDs = map[int]bool{1: true}
+	router := router(testBehavior)
 	testServer = httptest.NewServer(router)
 }
 
 func teardown() {
 	testServer.Close()
-	initPostTable()
-	db.Close()
-	os.Setenv("USER_URL", tmpBaseUserURL)
-	os.Setenv("POINT_URL", tmpBasePointURL)
 }
 
 func TestPostCreate(t *testing.T) {
@@ -68,13 +79,83 @@ func TestPostCreate(t *testing.T) {
 	assert.Equal(t, http.StatusCreated, resp.StatusCode)
 }
 
+func TestPostCreateInsufficientPoints(t *testing.T) {
+	initPostTable()
+	inputPost := struct {
+		Body  string `json:"body"`
+		Point uint   `json:"point"`
+		Token string `json:"token"`
+	}{
+		"tests",
+		100000,
+		"testToken",
+	}
+	response := struct {
+		Error string `json:"error"`
+	}{}
+	input, _ := json.Marshal(inputPost)
+	resp, err := http.Post(testServer.URL+"/posts", "application/json", bytes.NewBuffer(input))
+	assert.Equal(t, nil, err)
+	defer resp.Body.Close()
+	json.NewDecoder(resp.Body).Decode(&response)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "insufficient_points", response.Error)
+}
+
+func TestPostCreateBearer(t *testing.T) {
+	inputPost := struct {
+		Body  string `json:"body"`
+		Point uint   `json:"point"`
+	}{
+		"tests",
+		100,
+	}
+	input, _ := json.Marshal(inputPost)
+	req, _ := http.NewRequest(http.MethodPost, testServer.URL+"/posts", bytes.NewBuffer(input))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer testToken")
+	resp, err := httpClient.Do(req)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "", resp.Header.Get("Deprecation"))
+}
+
+func TestPostCreateUnauthorized(t *testing.T) {
+	inputPost := struct {
+		Body  string `json:"body"`
+		Point uint   `json:"point"`
+	}{
+		"tests",
+		100,
+	}
+	input, _ := json.Marshal(inputPost)
+	resp, err := http.Post(testServer.URL+"/posts", "application/json", bytes.NewBuffer(input))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestPostCreateAuthUnavailable(t *testing.T) {
+	testUsers.Err = client.ErrCircuitOpen
+	defer func() { testUsers.Err = nil }()
+
+	input, _ := json.Marshal(map[string]interface{}{"body": "tests", "point": 100})
+	req, _ := http.NewRequest(http.MethodPost, testServer.URL+"/posts", bytes.NewBuffer(input))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer testToken")
+	resp, err := httpClient.Do(req)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
 func TestPostCreateNumericErrValid(t *testing.T) {
 	inputPost := struct {
 		Body  string `json:"body"`
 		Point string `json:"point"`
+		Token string `json:"token"`
 	}{
 		"tests",
 		"tests",
+		"testToken",
 	}
 	input, _ := json.Marshal(inputPost)
 	resp, _ := http.Post(testServer.URL+"/posts", "application/json", bytes.NewBuffer(input))
@@ -85,9 +166,11 @@ func TestPostCreateMinusErrValid(t *testing.T) {
 	inputPost := struct {
 		Body  string `json:"body"`
 		Point int    `json:"point"`
+		Token string `json:"token"`
 	}{
 		"tests",
 		-1,
+		"testToken",
 	}
 	input, _ := json.Marshal(inputPost)
 	resp, _ := http.Post(testServer.URL+"/posts", "application/json", bytes.NewBuffer(input))
@@ -128,9 +211,168 @@ func TestPutDone(t *testing.T) {
 	assert.Equal(t, http.StatusCreated, resp.StatusCode)
 }
 
+func TestGetHistory(t *testing.T) {
+	response := []entity.PostEvent{}
+	error := struct {
+		Error string
+	}{}
+
+	initPostTable()
+	createDefaultPost(1, 1, 2)
+
+	inputPost := struct {
+		ID    int    `json:"id"`
+		Token string `json:"token"`
+	}{
+		1,
+		"testToken",
+	}
+	input, _ := json.Marshal(inputPost)
+	http.Post(testServer.URL+"/done", "application/json", bytes.NewBuffer(input))
+
+	resp, err := napping.Get(testServer.URL+"/posts/1/history", nil, &response, &error)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, resp.Status())
+	assert.Equal(t, 1, len(response))
+	assert.Equal(t, entity.Paid, response[0].NewStatus)
+}
+
+func TestPostDoneForbidden(t *testing.T) {
+	response := struct {
+		Error  string `json:"error"`
+		Reason string `json:"reason"`
+	}{}
+
+	initPostTable()
+	createDefaultPost(1, 2, 1)
+
+	inputPost := struct {
+		ID    int    `json:"id"`
+		Token string `json:"token"`
+	}{
+		1,
+		"testToken",
+	}
+	input, _ := json.Marshal(inputPost)
+
+	resp, err := http.Post(testServer.URL+"/done", "application/json", bytes.NewBuffer(input))
+	assert.Equal(t, nil, err)
+	defer resp.Body.Close()
+	json.NewDecoder(resp.Body).Decode(&response)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, "not_owner", response.Reason)
+}
+
+func TestPutPost(t *testing.T) {
+	initPostTable()
+	createDefaultPost(1, 1, 0)
+	createDefaultPost(2, 2, 0)
+
+	inputPost := struct {
+		Body   string `json:"body"`
+		UserID uint   `json:"userId"`
+		Token  string `json:"token"`
+	}{
+		"updated",
+		2,
+		"testToken",
+	}
+	input, _ := json.Marshal(inputPost)
+
+	response := entity.Post{}
+	error := struct {
+		Error string
+	}{}
+	resp, err := napping.Put(testServer.URL+"/posts/1", &inputPost, &response, &error)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusCreated, resp.Status())
+	assert.Equal(t, "updated", response.Body)
+	// 投稿者はクライアントから変更できない。
+	assert.Equal(t, uint(1), response.UserID)
+
+	req, _ := http.NewRequest(http.MethodPut, testServer.URL+"/posts/2", bytes.NewBuffer(input))
+	req.Header.Set("Content-Type", "application/json")
+	forbiddenResp, err := httpClient.Do(req)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusForbidden, forbiddenResp.StatusCode)
+}
+
+func TestPutPostMatched(t *testing.T) {
+	initPostTable()
+	createDefaultPost(1, 1, 2)
+
+	inputPost := struct {
+		Body  string `json:"body"`
+		Token string `json:"token"`
+	}{
+		"updated",
+		"testToken",
+	}
+
+	// ヘルパー決定後の編集は不正なリクエストと区別できるよう409で返却する。
+	response := struct {
+		Error  string `json:"error"`
+		Status string `json:"status"`
+		Event  string `json:"event"`
+	}{}
+	resp, err := napping.Put(testServer.URL+"/posts/1", &inputPost, nil, &response)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusConflict, resp.Status())
+	assert.Equal(t, "invalid_transition", response.Error)
+	assert.Equal(t, entity.Matched.String(), response.Status)
+	assert.Equal(t, "edit", response.Event)
+}
+
+func TestDeletePost(t *testing.T) {
+	initPostTable()
+	createDefaultPost(1, 1, 0)
+
+	input, _ := json.Marshal(struct {
+		Token string `json:"token"`
+	}{"testToken"})
+	req, _ := http.NewRequest(http.MethodDelete, testServer.URL+"/posts/1", bytes.NewBuffer(input))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, err = http.Get(testServer.URL + "/posts/1")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestGetSettlements(t *testing.T) {
+	response := []entity.Settlement{}
+	error := struct {
+		Error string
+	}{}
+
+	initPostTable()
+	createDefaultPost(1, 1, 2)
+
+	inputPost := struct {
+		ID    int    `json:"id"`
+		Token string `json:"token"`
+	}{
+		1,
+		"testToken",
+	}
+	input, _ := json.Marshal(inputPost)
+	http.Post(testServer.URL+"/done", "application/json", bytes.NewBuffer(input))
+
+	resp, err := napping.Get(testServer.URL+"/posts/1/settlements", nil, &response, &error)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, resp.Status())
+	assert.Equal(t, 1, len(response))
+	assert.Equal(t, entity.SettlementDelivered, response[0].Status)
+}
+
 func TestAmountGetByUserID(t *testing.T) {
 	response := struct {
 		AmountPayment int
+		Total         int
+		Held          int
+		Available     int
 	}{}
 	error := struct {
 		Error string
@@ -143,6 +385,8 @@ func TestAmountGetByUserID(t *testing.T) {
 	assert.Equal(t, nil, err)
 	assert.Equal(t, http.StatusOK, resp.Status())
 	assert.NotEqual(t, 0, response.AmountPayment)
+	assert.Equal(t, response.AmountPayment, response.Available)
+	assert.Equal(t, response.Total-response.Held, response.Available)
 }
 
 func TestGetUserByID(t *testing.T) {
@@ -166,6 +410,67 @@ func TestGetUserByID(t *testing.T) {
 	assert.Equal(t, 2, len(response))
 }
 
+func TestGetPostsCursor(t *testing.T) {
+	input := url.Values{
+		"limit": []string{"2"},
+	}
+
+	response := entity.PostPage{}
+	error := struct {
+		Error string
+	}{}
+
+	initPostTable()
+	createDefaultPost(0, 1, 3)
+	createDefaultPost(0, 1, 3)
+	createDefaultPost(0, 2, 3)
+
+	resp, err := napping.Get(testServer.URL+"/posts", &input, &response, &error)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, resp.Status())
+	assert.Equal(t, 2, len(response.Items))
+	assert.True(t, response.HasMore)
+
+	input.Set("cursor", response.NextCursor)
+	response = entity.PostPage{}
+	resp, err = napping.Get(testServer.URL+"/posts", &input, &response, &error)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, resp.Status())
+	assert.Equal(t, 1, len(response.Items))
+	assert.False(t, response.HasMore)
+	assert.Equal(t, "", response.NextCursor)
+
+	input.Set("cursor", "invalid!")
+	resp, err = napping.Get(testServer.URL+"/posts", &input, &response, &error)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, resp.Status())
+	assert.Equal(t, "invalid_cursor", error.Error)
+}
+
+func TestGetPostsUsersUnavailable(t *testing.T) {
+	input := url.Values{
+		"offset": []string{"0"},
+	}
+
+	response := []entity.JoinPost{}
+	error := struct {
+		Error string
+	}{}
+
+	initPostTable()
+	createDefaultPost(0, 1, 3)
+	testUsers.Err = errors.New("unavailable")
+	defer func() { testUsers.Err = nil }()
+
+	resp, err := napping.Get(testServer.URL+"/posts", &input, &response, &error)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, resp.Status())
+	assert.Equal(t, "users", resp.HttpResponse().Header.Get("X-Partial-Content"))
+	assert.Equal(t, 1, len(response))
+	assert.True(t, response[0].User.Unresolved)
+	assert.True(t, response[0].HelperUser.Unresolved)
+}
+
 func TestGetTagByBody(t *testing.T) {
 	response := []entity.Tag{}
 	error := struct {
@@ -208,50 +513,229 @@ func TestGetByTagID(t *testing.T) {
 }
 
 func createDefaultPost(id uint, userID uint, helpserUserID uint) entity.Post {
-	db := db.GetDB()
 	post := postDefault
 	post.ID = id
 	post.UserID = userID
 	post.HelperUserID = helpserUserID
-	db.Create(&post)
+	testStore.Posts().Create(&post)
 	return post
 }
 
 func createDefaultTag() entity.Tag {
-	db := db.GetDB()
 	tag := tagDefault
-	db.Create(&tag)
+	testStore.Tags().Create(&tag)
 	return tag
 }
 
 func createTestPostTag(postID uint, tagID uint) entity.PostTag {
-	db := db.GetDB()
 	createPostTag := entity.PostTag{
 		PostID: postID,
 		TagID:  tagID,
 	}
-	db.Create(&createPostTag)
+	testStore.PostTags().Create(&createPostTag)
 	return createPostTag
 }
 
+// initTable メモリ上のテーブルを全て空にする。
 func initTable() {
-	initPostTable()
-	initTagTable()
-	initPostTagsTable()
+	testStore.Reset()
 }
 
 func initPostTable() {
-	db := db.GetDB()
-	var u entity.Post
-	db.Delete(&u)
-}
-func initTagTable() {
-	db := db.GetDB()
-	var t entity.Tag
-	db.Delete(&t)
-}
-func initPostTagsTable() {
-	db := db.GetDB()
-	var pt entity.PostTag
-	db.Delete(&pt)
+	initTable()
+}
+
+func TestGetPostsFilter(t *testing.T) {
+	input := url.Values{
+		"user_id":   []string{"1"},
+		"no_helper": []string{"true"},
+	}
+
+	response := entity.PostPage{}
+	error := struct {
+		Error string
+		Param string
+	}{}
+
+	initPostTable()
+	post := createDefaultPost(0, 1, 0)
+	createDefaultPost(0, 1, 3)
+	createDefaultPost(0, 2, 0)
+
+	resp, err := napping.Get(testServer.URL+"/posts", &input, &response, &error)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, resp.Status())
+	assert.Equal(t, 1, len(response.Items))
+	assert.Equal(t, post.ID, response.Items[0].Post.ID)
+
+	input.Set("sort", "random")
+	resp, err = napping.Get(testServer.URL+"/posts", &input, &response, &error)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, resp.Status())
+	assert.Equal(t, "invalid_filter", error.Error)
+	assert.Equal(t, "sort", error.Param)
+}
+
+func TestSearchPosts(t *testing.T) {
+	input := url.Values{
+		"q": []string{"test"},
+	}
+
+	response := entity.PostPage{}
+	error := struct {
+		Error string
+		Param string
+	}{}
+
+	initPostTable()
+	post := createDefaultPost(0, 1, 0)
+
+	resp, err := napping.Get(testServer.URL+"/posts/search", &input, &response, &error)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, resp.Status())
+	assert.Equal(t, 1, len(response.Items))
+	assert.Equal(t, post.ID, response.Items[0].Post.ID)
+
+	input.Del("q")
+	resp, err = napping.Get(testServer.URL+"/posts/search", &input, &response, &error)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, resp.Status())
+	assert.Equal(t, "invalid_filter", error.Error)
+	assert.Equal(t, "q", error.Param)
+}
+
+func TestTags(t *testing.T) {
+	initTable()
+	from := createDefaultTag()
+	into := entity.Tag{Body: "test2", Slug: "test2"}
+	testStore.Tags().Create(&into)
+	post := createDefaultPost(0, 1, 0)
+	createTestPostTag(post.ID, from.ID)
+
+	token := "testToken"
+	request := func(method string, path string, body interface{}) *http.Response {
+		input, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, testServer.URL+path, bytes.NewBuffer(input))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := httpClient.Do(req)
+		assert.Equal(t, nil, err)
+		return resp
+	}
+	fromPath := "/tags/" + strconv.Itoa(int(from.ID))
+
+	// 管理者以外はタグを変更できない。
+	token = "helperToken"
+	resp := request(http.MethodPut, fromPath, map[string]interface{}{"body": "renamed"})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = request(http.MethodPost, fromPath+"/merge", map[string]interface{}{"into": into.ID})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = request(http.MethodDelete, fromPath, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	token = "testToken"
+
+	resp = request(http.MethodPut, fromPath, map[string]interface{}{"body": "test2"})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp = request(http.MethodDelete, fromPath, nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp = request(http.MethodPost, fromPath+"/merge", map[string]interface{}{"into": into.ID})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	response := []entity.TagCount{}
+	resp2, err := napping.Get(testServer.URL+"/tags", nil, &response, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, resp2.Status())
+	assert.Equal(t, []entity.TagCount{{Tag: into, PostCount: 1}}, response)
+
+	resp = request(http.MethodDelete, fromPath, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestPutPostTags(t *testing.T) {
+	initTable()
+	post := createDefaultPost(0, 1, 0)
+	tag := createDefaultTag()
+	createTestPostTag(post.ID, tag.ID)
+
+	inputPost := struct {
+		Tags      []entity.Tag `json:"tags"`
+		PruneTags bool         `json:"pruneTags"`
+		Token     string       `json:"token"`
+	}{
+		[]entity.Tag{{Body: "test2"}},
+		true,
+		"testToken",
+	}
+
+	response := entity.Post{}
+	resp, err := napping.Put(testServer.URL+"/posts/"+strconv.Itoa(int(post.ID)), &inputPost, &response, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusCreated, resp.Status())
+
+	tags, _ := testStore.Tags().FindByPostID(post.ID)
+	assert.Equal(t, 1, len(tags))
+	assert.Equal(t, "test2", tags[0].Body)
+	_, err = testStore.Tags().FindByID(tag.ID)
+	assert.Equal(t, repository.ErrNotFound, err)
+}
+
+func TestGetTrendingTags(t *testing.T) {
+	initTable()
+	tag := createDefaultTag()
+	post := createDefaultPost(0, 1, 0)
+	createTestPostTag(post.ID, tag.ID)
+
+	response := []entity.TagCount{}
+	error := struct {
+		Error string
+		Param string
+	}{}
+	input := url.Values{"window": []string{"24h"}, "open": []string{"true"}}
+	resp, err := napping.Get(testServer.URL+"/tags/trending", &input, &response, &error)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, resp.Status())
+	assert.Equal(t, []entity.TagCount{{Tag: tag, PostCount: 1}}, response)
+
+	input.Set("window", "1y")
+	resp, err = napping.Get(testServer.URL+"/tags/trending", &input, &response, &error)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, resp.Status())
+	assert.Equal(t, "window", error.Param)
+}
+
+func TestGetTagSuggestions(t *testing.T) {
+	initTable()
+	tag := createDefaultTag()
+	testBehavior.RefreshTagSuggestions()
+
+	response := []entity.TagCount{}
+	error := struct {
+		Error string
+		Param string
+	}{}
+	input := url.Values{"q": []string{"TE"}, "limit": []string{"5"}}
+	resp, err := napping.Get(testServer.URL+"/tags/suggest", &input, &response, &error)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, resp.Status())
+	assert.Equal(t, []entity.TagCount{{Tag: tag}}, response)
+
+	input = url.Values{"q": []string{""}}
+	resp, err = napping.Get(testServer.URL+"/tags/suggest", &input, &response, &error)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusBadRequest, resp.Status())
+	assert.Equal(t, "q", error.Param)
+}
+
+func TestDebugVarsNotPublic(t *testing.T) {
+	resp, err := http.Get(testServer.URL + "/debug/vars")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	debugServer := httptest.NewServer(debugHandler())
+	defer debugServer.Close()
+	resp, err = http.Get(debugServer.URL + "/debug/vars")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
 }
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+// LoadAdminUserIDs 環境変数ADMIN_USER_IDS(カンマ区切り)から管理者のユーザーIDを読み込む。
+func LoadAdminUserIDs() (map[int]bool, error) {
+	admins := map[int]bool{}
+	for _, value := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		admins[id] = true
+	}
+	return admins, nil
+}
+
+// IsAdmin ユーザーが管理者の場合にtrueを返却する。
+func (b Behavior) IsAdmin(user entity.AuthUser) bool {
+	return b.AdminUserIDs[user.ID]
+}
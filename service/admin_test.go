@@ -0,0 +1,31 @@
+package service
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+func TestLoadAdminUserIDs(t *testing.T) {
+	defer os.Unsetenv("ADMIN_USER_IDS")
+
+	os.Setenv("ADMIN_USER_IDS", "1, 3")
+	admins, err := LoadAdminUserIDs()
+	assert.Equal(t, nil, err)
+	b := testBehavior()
+	b.AdminUserIDs = admins
+	assert.True(t, b.IsAdmin(entity.AuthUser{ID: 3}))
+	assert.False(t, b.IsAdmin(entity.AuthUser{ID: 2}))
+
+	os.Setenv("ADMIN_USER_IDS", "")
+	admins, err = LoadAdminUserIDs()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(admins))
+
+	os.Setenv("ADMIN_USER_IDS", "admin")
+	_, err = LoadAdminUserIDs()
+	assert.NotEqual(t, nil, err)
+}
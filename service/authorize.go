@@ -0,0 +1,74 @@
+package service
+
+import (
+	"strconv"
+
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+const (
+	// ReasonNotOwner 投稿者以外が投稿者のみ可能な操作を行った。
+	ReasonNotOwner = "not_owner"
+	// ReasonNotHelper ヘルパー以外がヘルパーのみ可能な操作を行った。
+	ReasonNotHelper = "not_helper"
+	// ReasonNotParticipant 投稿者・ヘルパー以外が操作を行った。
+	ReasonNotParticipant = "not_owner_or_helper"
+	// ReasonOwnerCannotHelp 投稿者が自身の投稿のヘルパーになろうとした。
+	ReasonOwnerCannotHelp = "owner_cannot_help"
+)
+
+// ForbiddenError 操作を行う権限がない場合のエラー
+type ForbiddenError struct {
+	PostID uint
+	Event  Event
+	Reason string
+}
+
+func (e *ForbiddenError) Error() string {
+	return "PostID:" + strconv.Itoa(int(e.PostID)) + " forbidden to " + string(e.Event) + ": " + e.Reason
+}
+
+// permissions 操作ごとの権限判定。問題がなければ空文字、権限がなければ理由を返却する。
+var permissions = map[Event]func(post entity.Post, userID uint) string{
+	EventEdit:   ownerOnly,
+	EventCancel: ownerOnly,
+	EventMatch: func(post entity.Post, userID uint) string {
+		if post.UserID == userID {
+			return ReasonOwnerCannotHelp
+		}
+		return ""
+	},
+	EventUnmatch: func(post entity.Post, userID uint) string {
+		if post.UserID != userID && post.HelperUserID != userID {
+			return ReasonNotParticipant
+		}
+		return ""
+	},
+	EventPay: ownerOnly,
+	EventAccept: func(post entity.Post, userID uint) string {
+		if post.HelperUserID != userID {
+			return ReasonNotHelper
+		}
+		return ""
+	},
+}
+
+func ownerOnly(post entity.Post, userID uint) string {
+	if post.UserID != userID {
+		return ReasonNotOwner
+	}
+	return ""
+}
+
+// authorize ユーザーが投稿情報に対してeventの操作を行えるか確認する。
+func authorize(post entity.Post, userID int, event Event) error {
+	permission, ok := permissions[event]
+	if !ok {
+		return nil
+	}
+
+	if reason := permission(post, uint(userID)); reason != "" {
+		return &ForbiddenError{PostID: post.ID, Event: event, Reason: reason}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"strconv"
+
+	"github.com/SeijiOmi/posts-service/repository"
+)
+
+// InsufficientPointsError 投稿に必要なポイントが支払可能ポイントを超えている場合のエラー
+type InsufficientPointsError struct {
+	Balance   int
+	Committed int
+	Requested int
+}
+
+func (e *InsufficientPointsError) Error() string {
+	return "insufficient points: balance " + strconv.Itoa(e.Balance) +
+		", committed " + strconv.Itoa(e.Committed) +
+		", requested " + strconv.Itoa(e.Requested)
+}
+
+// checkBalance 投稿に必要なポイントが支払可能ポイントに収まるか確認する。
+// excludePostIDの投稿は確保中ポイントから除外する（更新時に変更前のポイントを数えないため）。
+// 同時実行されても残高を超えないよう、同じトランザクションでLockUserの後に呼び出すこと。
+func checkBalance(tx repository.Store, userID uint, excludePostID uint, point uint, ledger int) error {
+	held, funded, err := escrowByUserID(tx, userID, excludePostID)
+	if err != nil {
+		return err
+	}
+
+	balance := pointBalance(ledger, held, funded)
+	if int(point) > balance.Available {
+		return &InsufficientPointsError{Balance: balance.Total, Committed: held, Requested: int(point)}
+	}
+
+	return nil
+}
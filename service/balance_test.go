@@ -0,0 +1,57 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+// ポイントサービスのモックは全ユーザーの保有ポイントを1000として返却する。
+
+func TestCreateModelInsufficientPoints(t *testing.T) {
+	initTable()
+	b := testBehavior()
+
+	_, err := b.CreateModel(ctx, entity.JoinPost{Post: entity.Post{Body: "test", Point: 600}}, testUser)
+	assert.Equal(t, nil, err)
+
+	_, err = b.CreateModel(ctx, entity.JoinPost{Post: entity.Post{Body: "test", Point: 600}}, testUser)
+	insufficient, ok := err.(*InsufficientPointsError)
+	assert.True(t, ok)
+	assert.Equal(t, 1000, insufficient.Balance)
+	assert.Equal(t, 600, insufficient.Committed)
+	assert.Equal(t, 600, insufficient.Requested)
+
+	posts, _ := b.FindByField(FieldUserID, 1, 0)
+	assert.Equal(t, 1, len(posts))
+}
+
+func TestCreateModelPaidPostNotCommitted(t *testing.T) {
+	initTable()
+	createStatusPost(0, 1, 2, entity.Accepted)
+	b := testBehavior()
+
+	_, err := b.CreateModel(ctx, entity.JoinPost{Post: entity.Post{Body: "test", Point: 1000}}, testUser)
+	assert.Equal(t, nil, err)
+}
+
+func TestUpdateByIDInsufficientPoints(t *testing.T) {
+	initPostTable()
+	createDefaultPost(1, 1, 0)
+	b := testBehavior()
+
+	point := uint(1000)
+	post, err := b.UpdateByID(ctx, "1", entity.PostUpdate{Point: &point}, testUser)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, point, post.Point)
+
+	point = 1001
+	_, err = b.UpdateByID(ctx, "1", entity.PostUpdate{Point: &point}, testUser)
+	assert.IsType(t, &InsufficientPointsError{}, err)
+
+	// 減らす場合は確認しない。
+	point = 10
+	_, err = b.UpdateByID(ctx, "1", entity.PostUpdate{Point: &point}, testUser)
+	assert.Equal(t, nil, err)
+}
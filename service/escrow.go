@@ -0,0 +1,91 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/SeijiOmi/posts-service/repository"
+)
+
+// applyEscrow 投稿情報の状態遷移に合わせてエスクローを操作する。
+//
+// 投稿時に投稿者のポイントを確保(hold)し、取り消し時に解除(release)、
+// ヘルパーの受け取り時に確定(capture)する。支払時点では確保したままにし、
+// 投稿者の支払がポイントサービスに計上された時点でfundedとする。
+func applyEscrow(tx repository.Store, post entity.Post, event Event) error {
+	switch event {
+	case EventCreate, EventEdit:
+		return holdPoints(tx, post)
+	case EventCancel:
+		return setHoldStatus(tx, post.ID, entity.HoldReleased)
+	case EventAccept:
+		return setHoldStatus(tx, post.ID, entity.HoldCaptured)
+	}
+	return nil
+}
+
+// ErrHoldNotHeld 投稿のエスクローが既に解除・確定されている。
+var ErrHoldNotHeld = errors.New("hold is not held")
+
+// holdPoints 投稿のポイントを確保する。確保済みの場合はポイントを更新する。
+// 解除・確定済みのエスクローは更新できないため、ErrHoldNotHeldを返却する。
+func holdPoints(tx repository.Store, post entity.Post) error {
+	hold, err := tx.Holds().FindByPostID(post.ID)
+	if err == repository.ErrNotFound {
+		hold := entity.Hold{
+			PostID: post.ID,
+			UserID: post.UserID,
+			Point:  int(post.Point),
+			Status: entity.HoldHeld,
+		}
+		return tx.Holds().Create(&hold)
+	}
+	if err != nil {
+		return err
+	}
+	if hold.Status != entity.HoldHeld {
+		return fmt.Errorf("%w: postID:%d status %s", ErrHoldNotHeld, post.ID, hold.Status)
+	}
+
+	return tx.Holds().UpdateHeldPoint(post.ID, int(post.Point))
+}
+
+func setHoldStatus(tx repository.Store, postID uint, status entity.HoldStatus) error {
+	return tx.Holds().UpdateHeldStatus(postID, status)
+}
+
+// fundHold 投稿者の支払がポイントサービスに計上されたことを記録する。
+func fundHold(store repository.Store, postID uint) error {
+	return store.Holds().SetFunded(postID)
+}
+
+// escrowByUserID ユーザーの確保中ポイントと、そのうち支払が計上済みのポイントを集計する。
+// excludePostIDの投稿は集計から除外する。
+func escrowByUserID(tx repository.Store, userID uint, excludePostID uint) (int, int, error) {
+	holds, err := tx.Holds().FindHeldByUserID(userID, excludePostID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	held, funded := 0, 0
+	for _, hold := range holds {
+		held += hold.Point
+		if hold.Funded {
+			funded += hold.Point
+		}
+	}
+
+	return held, funded, nil
+}
+
+// pointBalance ポイントサービスの残高とエスクローから残高を算出する。
+// 支払計上済みの確保分はポイントサービスの残高から既に引かれているため、保有ポイントに戻して扱う。
+func pointBalance(ledger int, held int, funded int) entity.PointBalance {
+	total := ledger + funded
+	return entity.PointBalance{
+		Total:     total,
+		Held:      held,
+		Available: total - held,
+	}
+}
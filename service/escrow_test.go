@@ -0,0 +1,102 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscrowLifecycle(t *testing.T) {
+	initTable()
+	b := testBehavior()
+	created, err := b.CreateModel(ctx, entity.JoinPost{Post: postDefault}, testUser)
+	assert.Equal(t, nil, err)
+	id := strconv.Itoa(int(created.Post.ID))
+
+	hold := findHold(created.Post.ID)
+	assert.Equal(t, entity.HoldHeld, hold.Status)
+	assert.Equal(t, int(postDefault.Point), hold.Point)
+
+	created.Post.HelperUserID = 2
+	testStore.Posts().Save(&created.Post)
+	_, err = b.DonePayment(ctx, id, testUser)
+	assert.Equal(t, nil, err)
+
+	// 支払後もヘルパーが受け取るまでは確保したままにする。
+	hold = findHold(created.Post.ID)
+	assert.Equal(t, entity.HoldHeld, hold.Status)
+	assert.True(t, hold.Funded)
+
+	balance, _ := b.GetBalanceByUserID(ctx, "1")
+	assert.Equal(t, int(postDefault.Point), balance.Held)
+
+	_, err = b.DoneAcceptance(ctx, id, entity.AuthUser{ID: 2, Token: "testToken"})
+	assert.Equal(t, nil, err)
+	hold = findHold(created.Post.ID)
+	assert.Equal(t, entity.HoldCaptured, hold.Status)
+}
+
+func TestEscrowRelease(t *testing.T) {
+	initTable()
+	b := testBehavior()
+	created, _ := b.CreateModel(ctx, entity.JoinPost{Post: postDefault}, testUser)
+
+	err := b.DeleteByID(strconv.Itoa(int(created.Post.ID)), testUser)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, entity.HoldReleased, findHold(created.Post.ID).Status)
+
+	balance, _ := b.GetBalanceByUserID(ctx, "1")
+	assert.Equal(t, 0, balance.Held)
+}
+
+func TestPointBalance(t *testing.T) {
+	// 支払未計上: 保有1000のうち100を確保
+	assert.Equal(t, entity.PointBalance{Total: 1000, Held: 100, Available: 900}, pointBalance(1000, 100, 0))
+	// 支払計上済み: ポイントサービス上は900だが、確保中の100は投稿者の保有として扱う
+	assert.Equal(t, entity.PointBalance{Total: 1000, Held: 100, Available: 900}, pointBalance(900, 100, 100))
+}
+
+func findHold(postID uint) entity.Hold {
+	hold, _ := testStore.Holds().FindByPostID(postID)
+	return hold
+}
+
+func TestCreateModelIgnoresID(t *testing.T) {
+	initTable()
+	b := testBehavior()
+	post := postDefault
+	post.Point = 900
+	created, err := b.CreateModel(ctx, entity.JoinPost{Post: post}, testUser)
+	assert.Equal(t, nil, err)
+	cancelledID := created.Post.ID
+	assert.Equal(t, nil, b.DeleteByID(strconv.Itoa(int(cancelledID)), testUser))
+
+	// 取り消した投稿のIDを指定しても、新しいIDで投稿しポイントを確保する。
+	post.ID = cancelledID
+	recreated, err := b.CreateModel(ctx, entity.JoinPost{Post: post}, testUser)
+	assert.Equal(t, nil, err)
+	assert.NotEqual(t, cancelledID, recreated.Post.ID)
+	assert.Equal(t, entity.HoldHeld, findHold(recreated.Post.ID).Status)
+	assert.Equal(t, entity.HoldReleased, findHold(cancelledID).Status)
+
+	balance, _ := b.GetBalanceByUserID(ctx, "1")
+	assert.Equal(t, entity.PointBalance{Total: 1000, Held: 900, Available: 100}, balance)
+
+	events, _ := testStore.PostEvents().FindByPostID(recreated.Post.ID)
+	assert.Equal(t, 1, len(events))
+}
+
+func TestHoldPointsNotHeld(t *testing.T) {
+	initTable()
+	b := testBehavior()
+	created, _ := b.CreateModel(ctx, entity.JoinPost{Post: postDefault}, testUser)
+	b.DeleteByID(strconv.Itoa(int(created.Post.ID)), testUser)
+
+	// 解除済みのエスクローは確保し直さない。
+	err := holdPoints(testStore, created.Post)
+	assert.True(t, errors.Is(err, ErrHoldNotHeld))
+	assert.Equal(t, entity.HoldReleased, findHold(created.Post.ID).Status)
+}
@@ -0,0 +1,95 @@
+//go:build integration
+// +build integration
+
+package service
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SeijiOmi/posts-service/db"
+	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/SeijiOmi/posts-service/repository"
+)
+
+// MySQLを使用するテスト。DB_USER / DB_PASSWORD / DB_ADDRESS / DB_NAME の接続先のテーブルを空にして実行する。
+// go test -tags integration -run MySQL ./service
+
+var initDB sync.Once
+
+// mysqlBehavior MySQLに接続したBehaviorを生成する。
+func mysqlBehavior() Behavior {
+	initDB.Do(db.Init)
+	initTable()
+
+	gdb := db.GetDB()
+	for _, table := range []string{"post_tags", "post_events", "settlements", "holds", "user_locks", "tags", "posts"} {
+		gdb.Exec("DELETE FROM " + table)
+	}
+
+	b := testBehavior()
+	b.Store = repository.NewGormStore(gdb)
+	return b
+}
+
+func TestCreateModelConcurrentMySQL(t *testing.T) {
+	b := mysqlBehavior()
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := b.CreateModel(ctx, entity.JoinPost{Post: entity.Post{Body: "test", Point: 200}}, testUser)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// user_locksにより残高確認が直列化され、保有1000ポイントに対して200ポイントの投稿は5件まで
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+		} else {
+			assert.IsType(t, &InsufficientPointsError{}, err)
+		}
+	}
+	assert.Equal(t, 5, succeeded)
+}
+
+func TestSetHelpUserIDConcurrentEditMySQL(t *testing.T) {
+	b := mysqlBehavior()
+	created, err := b.CreateModel(ctx, entity.JoinPost{Post: postDefault}, testUser)
+	assert.Equal(t, nil, err)
+	id := created.Post.ID
+	postID := strconv.Itoa(int(id))
+	body := "updated"
+
+	for i := 0; i < 10; i++ {
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			b.SetHelpUserID(ctx, postID, entity.AuthUser{ID: 2})
+		}()
+		go func() {
+			defer wg.Done()
+			b.UpdateByID(ctx, postID, entity.PostUpdate{Body: &body}, testUser)
+		}()
+		wg.Wait()
+
+		// ヘルパー決定と編集が同時に行われても、ヘルパーは消えない。
+		post, err := b.Store.Posts().FindByID(id)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, entity.Matched, post.Status)
+		assert.Equal(t, uint(2), post.HelperUserID)
+
+		_, err = b.TakeHelpUserID(ctx, postID, entity.AuthUser{ID: 2})
+		assert.Equal(t, nil, err)
+	}
+}
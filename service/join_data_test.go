@@ -0,0 +1,81 @@
+package service
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/SeijiOmi/posts-service/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStore タグの問い合わせ回数を数えるStore
+type countingStore struct {
+	repository.Store
+	tagQueries int64
+}
+
+func (s *countingStore) Tags() repository.TagRepository {
+	return countingTagRepository{s.Store.Tags(), &s.tagQueries}
+}
+
+type countingTagRepository struct {
+	repository.TagRepository
+	queries *int64
+}
+
+func (r countingTagRepository) FindByPostID(postID uint) ([]entity.Tag, error) {
+	atomic.AddInt64(r.queries, 1)
+	return r.TagRepository.FindByPostID(postID)
+}
+
+func (r countingTagRepository) FindByPostIDs(postIDs []uint) (map[uint][]entity.Tag, error) {
+	atomic.AddInt64(r.queries, 1)
+	return r.TagRepository.FindByPostIDs(postIDs)
+}
+
+// createTaggedPosts タグを2つずつ付けた投稿情報をn件作成する。
+func createTaggedPosts(n int) []entity.Post {
+	initTable()
+	var posts []entity.Post
+	for i := 0; i < n; i++ {
+		post := createDefaultPost(0, 1, 2)
+		for j := 0; j < 2; j++ {
+			tag := createBodyTag("tag" + strconv.Itoa(i) + "-" + strconv.Itoa(j))
+			createTestPostTag(post.ID, tag.ID)
+		}
+		posts = append(posts, post)
+	}
+	return posts
+}
+
+func TestAttachJoinDataTagQueries(t *testing.T) {
+	for _, n := range []int{1, 10, 40} {
+		posts := createTaggedPosts(n)
+		store := &countingStore{Store: testStore}
+		behavior := NewBehavior(store, testUsers, testPoints)
+
+		joinPosts, err := behavior.attachJoinData(ctx, posts)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, n, len(joinPosts))
+		assert.Equal(t, 2, len(joinPosts[n-1].Tags))
+		assert.Equal(t, int64(1), store.tagQueries)
+	}
+}
+
+func BenchmarkAttachJoinData(b *testing.B) {
+	for _, n := range []int{10, 40, 160} {
+		b.Run(strconv.Itoa(n)+"posts", func(b *testing.B) {
+			posts := createTaggedPosts(n)
+			store := &countingStore{Store: testStore}
+			behavior := NewBehavior(store, testUsers, testPoints)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				behavior.attachJoinData(ctx, posts)
+			}
+			b.ReportMetric(float64(store.tagQueries)/float64(b.N), "tag-queries/op")
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strconv"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// JWTVerifier ユーザーサービスへ問い合わせずにトークンを検証する。
+type JWTVerifier struct {
+	hmacKeys  map[string][]byte
+	rsaKeys   map[string]*rsa.PublicKey
+	userClaim string
+}
+
+// LoadJWTVerifier 環境変数からJWTのローカル検証設定を読み込む。
+// JWT_VERIFY_MODEがlocal以外の場合はnilを返却し、ユーザーサービスの/authでトークンを検証する。
+func LoadJWTVerifier() (*JWTVerifier, error) {
+	if os.Getenv("JWT_VERIFY_MODE") != "local" {
+		return nil, nil
+	}
+
+	return newJWTVerifier(
+		os.Getenv("JWT_HMAC_SECRET"),
+		os.Getenv("JWT_RSA_PUBLIC_KEY_FILE"),
+		os.Getenv("JWT_JWKS_FILE"),
+		os.Getenv("JWT_USER_ID_CLAIM"),
+	)
+}
+
+func newJWTVerifier(hmacSecret string, rsaKeyFile string, jwksFile string, userClaim string) (*JWTVerifier, error) {
+	v := &JWTVerifier{
+		hmacKeys:  map[string][]byte{},
+		rsaKeys:   map[string]*rsa.PublicKey{},
+		userClaim: userClaim,
+	}
+	if v.userClaim == "" {
+		v.userClaim = "id"
+	}
+
+	if hmacSecret != "" {
+		v.hmacKeys[""] = []byte(hmacSecret)
+	}
+
+	if rsaKeyFile != "" {
+		pem, err := ioutil.ReadFile(rsaKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, err
+		}
+		v.rsaKeys[""] = key
+	}
+
+	if jwksFile != "" {
+		if err := v.loadJWKS(jwksFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(v.hmacKeys) == 0 && len(v.rsaKeys) == 0 {
+		return nil, errors.New("jwt local verification enabled but no key configured")
+	}
+
+	return v, nil
+}
+
+// loadJWKS JWKSファイルからRSA(kty=RSA)とHMAC(kty=oct)の鍵を読み込む。
+func (v *JWTVerifier) loadJWKS(path string) error {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(buf, &jwks); err != nil {
+		return err
+	}
+
+	for _, key := range jwks.Keys {
+		switch key.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(key.N)
+			if err != nil {
+				return err
+			}
+			e, err := base64.RawURLEncoding.DecodeString(key.E)
+			if err != nil {
+				return err
+			}
+			v.rsaKeys[key.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "oct":
+			k, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil {
+				return err
+			}
+			v.hmacKeys[key.Kid] = k
+		}
+	}
+
+	return nil
+}
+
+// keyFunc 署名方式とkidに合う鍵を返却する。署名方式と鍵の種類が一致しない場合は拒否する。
+func (v *JWTVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if key, ok := v.hmacKeys[kid]; ok {
+			return key, nil
+		}
+		if key, ok := v.hmacKeys[""]; ok {
+			return key, nil
+		}
+	case *jwt.SigningMethodRSA:
+		if key, ok := v.rsaKeys[kid]; ok {
+			return key, nil
+		}
+		if key, ok := v.rsaKeys[""]; ok {
+			return key, nil
+		}
+	default:
+		return nil, errors.New("unexpected signing method: " + token.Method.Alg())
+	}
+
+	return nil, errors.New("no key for kid: " + kid)
+}
+
+// verify トークンの署名と有効期限を検証し、ユーザーIDを返却する。
+func (v *JWTVerifier) verify(tokenString string) (int, error) {
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(tokenString, claims, v.keyFunc); err != nil {
+		return 0, err
+	}
+
+	// 有効期限の無いトークンは受け付けない。
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return 0, errors.New("token has no expiry")
+	}
+
+	switch id := claims[v.userClaim].(type) {
+	case float64:
+		return int(id), nil
+	case string:
+		return strconv.Atoi(id)
+	}
+
+	return 0, errors.New("token has no user id claim: " + v.userClaim)
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SeijiOmi/posts-service/client"
+)
+
+func TestJWTVerifyHMAC(t *testing.T) {
+	v, err := newJWTVerifier("secret", "", "", "")
+	assert.Equal(t, nil, err)
+
+	token := signTestToken(t, jwt.SigningMethodHS256, []byte("secret"), "", jwt.MapClaims{
+		"id":  float64(3),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	userID, err := v.verify(token)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, userID)
+
+	expired := signTestToken(t, jwt.SigningMethodHS256, []byte("secret"), "", jwt.MapClaims{
+		"id":  float64(3),
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	})
+	_, err = v.verify(expired)
+	assert.NotEqual(t, nil, err)
+
+	noExpiry := signTestToken(t, jwt.SigningMethodHS256, []byte("secret"), "", jwt.MapClaims{
+		"id": float64(3),
+	})
+	_, err = v.verify(noExpiry)
+	assert.NotEqual(t, nil, err)
+
+	wrongKey := signTestToken(t, jwt.SigningMethodHS256, []byte("other"), "", jwt.MapClaims{
+		"id":  float64(3),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	_, err = v.verify(wrongKey)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestAuthenticateJWTVerifier(t *testing.T) {
+	v, err := newJWTVerifier("secret", "", "", "")
+	assert.Equal(t, nil, err)
+	b := testBehavior()
+	b.Verifier = v
+
+	token := signTestToken(t, jwt.SigningMethodHS256, []byte("secret"), "", jwt.MapClaims{
+		"id":  float64(3),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	user, err := b.Authenticate(ctx, token)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, user.ID)
+
+	// Verifierを設定したBehaviorのみローカル検証する。
+	_, err = b.Authenticate(ctx, "testToken")
+	assert.True(t, errors.Is(err, client.ErrInvalidToken))
+	_, err = testBehavior().Authenticate(ctx, "testToken")
+	assert.Equal(t, nil, err)
+}
+
+func TestJWTVerifyRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Equal(t, nil, err)
+
+	dir, err := ioutil.TempDir("", "jwt")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.Equal(t, nil, err)
+	pemFile := filepath.Join(dir, "public.pem")
+	ioutil.WriteFile(pemFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+
+	v, err := newJWTVerifier("", pemFile, "", "sub")
+	assert.Equal(t, nil, err)
+
+	token := signTestToken(t, jwt.SigningMethodRS256, key, "", jwt.MapClaims{
+		"sub": "5",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	userID, err := v.verify(token)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 5, userID)
+
+	// 公開鍵をHMACの鍵として扱わせる署名方式のすり替えは拒否する。
+	forged := signTestToken(t, jwt.SigningMethodHS256, der, "", jwt.MapClaims{
+		"sub": "5",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	_, err = v.verify(forged)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestJWTVerifyJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Equal(t, nil, err)
+
+	dir, err := ioutil.TempDir("", "jwt")
+	assert.Equal(t, nil, err)
+	defer os.RemoveAll(dir)
+
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": "key1",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			},
+		},
+	}
+	buf, _ := json.Marshal(jwks)
+	jwksFile := filepath.Join(dir, "jwks.json")
+	ioutil.WriteFile(jwksFile, buf, 0600)
+
+	v, err := newJWTVerifier("", "", jwksFile, "")
+	assert.Equal(t, nil, err)
+
+	token := signTestToken(t, jwt.SigningMethodRS256, key, "key1", jwt.MapClaims{
+		"id":  float64(7),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	userID, err := v.verify(token)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 7, userID)
+
+	unknownKid := signTestToken(t, jwt.SigningMethodRS256, key, "key2", jwt.MapClaims{
+		"id":  float64(7),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	_, err = v.verify(unknownKid)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestNewJWTVerifierNoKey(t *testing.T) {
+	_, err := newJWTVerifier("", "", "", "")
+	assert.NotEqual(t, nil, err)
+}
+
+func signTestToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	assert.Equal(t, nil, err)
+	return signed
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// TagNormalizer タグ名を照合用の正規化した値(slug)に変換する。
+// FoldKanaを変更すると既存のslugと一致しなくなるため、変更した場合はslugを作り直すこと。
+type TagNormalizer struct {
+	// FoldKana trueの場合はカタカナをひらがなに揃える。
+	FoldKana bool
+}
+
+// LoadTagNormalizer 環境変数TAG_FOLD_KANAからタグ名の正規化の設定を読み込む。
+func LoadTagNormalizer() TagNormalizer {
+	return TagNormalizer{FoldKana: os.Getenv("TAG_FOLD_KANA") == "true"}
+}
+
+// Body 表示用のタグ名。前後の空白のみ取り除き、入力された表記を残す。
+func (n TagNormalizer) Body(body string) string {
+	return strings.TrimSpace(body)
+}
+
+// Slug 照合用のタグ名。
+// NFKCで全角英数字を半角に、半角カナを全角に揃えた上で、大文字・小文字を区別しないよう畳み込む。
+// 前後の空白は取り除き、連続する空白は1つの空白にまとめる。
+func (n TagNormalizer) Slug(body string) string {
+	slug := norm.NFKC.String(body)
+	slug = cases.Fold().String(slug)
+	slug = strings.Join(strings.FieldsFunc(slug, unicode.IsSpace), " ")
+	if n.FoldKana {
+		slug = foldKana(slug)
+	}
+	return slug
+}
+
+// foldKana カタカナをひらがなに変換する。長音記号などひらがなに無い文字はそのままとする。
+func foldKana(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'ァ' && r <= 'ヶ', r == 'ヽ', r == 'ヾ':
+			return r - ('ァ' - 'ぁ')
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+func TestTagNormalizerSlug(t *testing.T) {
+	cases := []struct {
+		body     string
+		slug     string
+		kanaSlug string
+	}{
+		{"Shopping", "shopping", "shopping"},
+		{" shopping ", "shopping", "shopping"},
+		{"ｓｈｏｐｐｉｎｇ", "shopping", "shopping"},
+		{"ＳＨＯＰ　ｐｉｎｇ", "shop ping", "shop ping"},
+		{"ｶｲﾓﾉ", "カイモノ", "かいもの"},
+		{"ｶﾞｰﾃﾞﾝ", "ガーデン", "がーでん"},
+		{"かいもの", "かいもの", "かいもの"},
+		{"犬の散歩", "犬の散歩", "犬の散歩"},
+		{"①", "1", "1"},
+		{"　", "", ""},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.slug, TagNormalizer{}.Slug(c.body), c.body)
+		assert.Equal(t, c.kanaSlug, TagNormalizer{FoldKana: true}.Slug(c.body), c.body)
+	}
+}
+
+func TestTagNormalizerBody(t *testing.T) {
+	assert.Equal(t, "ｓｈｏｐｐｉｎｇ", TagNormalizer{}.Body(" ｓｈｏｐｐｉｎｇ\n"))
+}
+
+func TestCreateModelNormalizesTags(t *testing.T) {
+	initTable()
+	b := testBehavior()
+	post, err := b.CreateModel(ctx, entity.JoinPost{
+		Post: entity.Post{Body: "test", Point: 100},
+		Tags: []entity.Tag{{Body: "Shopping"}, {Body: " shopping"}, {Body: "ｓｈｏｐｐｉｎｇ"}, {Body: " "}},
+	}, testUser)
+	assert.Equal(t, nil, err)
+	// 最初に入力された表記で1つだけ作成される。
+	assert.Equal(t, []entity.Tag{{ID: 1, Body: "Shopping", Slug: "shopping"}}, post.Tags)
+
+	tags, err := b.FindTagLikeBody("ＳＨＯＰ")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, post.Tags, tags)
+}
+
+func TestBackfillTagSlugs(t *testing.T) {
+	initTable()
+	first := entity.Tag{Body: "Shopping"}
+	testStore.Tags().Create(&first)
+	second := entity.Tag{ID: 2, Body: "ｓｈｏｐｐｉｎｇ"}
+	testStore.Tags().Save(&second)
+	post := createDefaultPost(0, 1, 0)
+	createTestPostTag(post.ID, second.ID)
+
+	b := testBehavior()
+	assert.Equal(t, nil, b.BackfillTagSlugs())
+
+	// 正規化したタグ名が同じタグは古いタグに統合される。
+	tags, _ := b.GetTags()
+	assert.Equal(t, []entity.TagCount{
+		{Tag: entity.Tag{ID: first.ID, Body: "Shopping", Slug: "shopping"}, PostCount: 1},
+	}, tags)
+
+	// 設定済みのタグは変更しない。
+	assert.Equal(t, nil, b.BackfillTagSlugs())
+	tags, _ = b.GetTags()
+	assert.Equal(t, 1, tags[0].PostCount)
+}
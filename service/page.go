@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/SeijiOmi/posts-service/repository"
+)
+
+// maxLimit 1ページに取得できる投稿情報の上限
+const maxLimit = 100
+
+// ErrInvalidCursor cursorの形式が不正
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page 一覧取得のページ指定
+type Page struct {
+	// Cursor 前のページのNextCursor。空の場合は先頭ページ。
+	Cursor string
+	// Offset 旧クライアント向け。Cursorが指定された場合は使用しない。
+	Offset int
+	// Limit 0の場合は既定の件数。maxLimitを超える場合はmaxLimitとする。
+	Limit int
+}
+
+// cursor ページの境界。クライアントには中身を公開しない。
+// 並び順のキーを含むため、異なる並び順のcursorは使用できない。
+// 関連度順の場合は関連度が変わりうるため、位置の代わりに取得済みの件数(Offset)を持つ。
+type cursor struct {
+	ID     uint   `json:"id,omitempty"`
+	Point  uint   `json:"point,omitempty"`
+	Offset int    `json:"offset,omitempty"`
+	Sort   string `json:"sort,omitempty"`
+}
+
+// newCursor 並び順におけるpostの位置を示すcursorを生成する。
+// 新しい順の場合はSortを省略し、並び順の指定が無かった頃のcursorと同じ形式とする。
+func newCursor(post entity.Post, sort repository.Sort, offset int) cursor {
+	switch sort {
+	case repository.SortRelevance:
+		return cursor{Offset: offset, Sort: sortNames[sort]}
+	case repository.SortNewest:
+		return cursor{ID: post.ID}
+	case repository.SortPoint:
+		return cursor{ID: post.ID, Point: post.Point, Sort: sortNames[sort]}
+	}
+	return cursor{ID: post.ID, Sort: sortNames[sort]}
+}
+
+// page cursorの次のページの取得範囲を取得する。sortと異なる並び順のcursorの場合はErrInvalidCursorを返却する。
+func (c cursor) page(sort repository.Sort, limit int) (repository.Page, error) {
+	if c.Sort == "" {
+		c.Sort = sortNames[repository.SortNewest]
+	}
+	if c.Sort != sortNames[sort] {
+		return repository.Page{}, ErrInvalidCursor
+	}
+	if sort == repository.SortRelevance {
+		return repository.Page{Offset: c.Offset, Limit: limit}, nil
+	}
+	return repository.Page{After: &repository.PostKey{ID: c.ID, Point: c.Point}, Limit: limit}, nil
+}
+
+func encodeCursor(c cursor) string {
+	buf, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(buf, &c); err != nil || c.ID == 0 && c.Offset <= 0 {
+		return cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+func (p Page) limit() int {
+	switch {
+	case p.Limit <= 0:
+		return limit
+	case p.Limit > maxLimit:
+		return maxLimit
+	}
+	return p.Limit
+}
+
+// findPage 条件に一致する投稿情報を1ページ分取得する。
+// 次のページの有無を判定するため、1件多く取得する。
+func findPage(store repository.Store, query *PostQuery, page Page) ([]entity.Post, string, bool, error) {
+	filter := query.filter
+	find := repository.Page{Offset: page.Offset, Limit: page.limit() + 1}
+	if page.Cursor != "" {
+		c, err := decodeCursor(page.Cursor)
+		if err != nil {
+			return nil, "", false, err
+		}
+		if find, err = c.page(filter.Sort, page.limit()+1); err != nil {
+			return nil, "", false, err
+		}
+	}
+
+	posts, err := store.Posts().Find(filter, find)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	if len(posts) <= page.limit() {
+		return posts, "", false, nil
+	}
+
+	posts = posts[:page.limit()]
+	next := newCursor(posts[len(posts)-1], filter.Sort, find.Offset+len(posts))
+	return posts, encodeCursor(next), true, nil
+}
+
+// attachJoinDataPage 条件に一致する1ページ分の投稿情報にユーザ情報を紐づける。
+func (b Behavior) attachJoinDataPage(ctx context.Context, query *PostQuery, page Page) (entity.PostPage, error) {
+	posts, next, hasMore, err := findPage(b.Store, query, page)
+	if err != nil {
+		return entity.PostPage{}, err
+	}
+
+	items, err := b.attachJoinData(ctx, posts)
+	if err != nil {
+		return entity.PostPage{}, err
+	}
+	if items == nil {
+		items = []entity.JoinPost{}
+	}
+
+	return entity.PostPage{Items: items, NextCursor: next, HasMore: hasMore}, nil
+}
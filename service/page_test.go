@@ -0,0 +1,66 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAllAttachJoinDataCursor(t *testing.T) {
+	initTable()
+	for i := 0; i < 5; i++ {
+		createDefaultPost(0, 1, 2)
+	}
+	b := testBehavior()
+
+	var ids []uint
+	page := Page{Limit: 2}
+	for i := 0; i < 3; i++ {
+		result, err := b.GetAllAttachJoinData(ctx, page)
+		assert.Equal(t, nil, err)
+		for _, item := range result.Items {
+			ids = append(ids, item.Post.ID)
+		}
+		assert.Equal(t, i < 2, result.HasMore)
+		page.Cursor = result.NextCursor
+	}
+
+	// 新しい順に重複・欠落なく取得できる。
+	assert.Equal(t, []uint{5, 4, 3, 2, 1}, ids)
+	assert.Equal(t, "", page.Cursor)
+}
+
+func TestGetAllAttachJoinDataCursorStable(t *testing.T) {
+	initTable()
+	for i := 0; i < 3; i++ {
+		createDefaultPost(0, 1, 2)
+	}
+	b := testBehavior()
+
+	first, _ := b.GetAllAttachJoinData(ctx, Page{Limit: 2})
+	// ページ取得の間に投稿が増えても、次のページがずれない。
+	createDefaultPost(0, 1, 2)
+	second, err := b.GetAllAttachJoinData(ctx, Page{Cursor: first.NextCursor, Limit: 2})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(second.Items))
+	assert.Equal(t, uint(1), second.Items[0].Post.ID)
+}
+
+func TestPageLimit(t *testing.T) {
+	assert.Equal(t, limit, Page{}.limit())
+	assert.Equal(t, 10, Page{Limit: 10}.limit())
+	assert.Equal(t, maxLimit, Page{Limit: maxLimit + 1}.limit())
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	for _, c := range []string{"invalid!", encodeCursor(cursor{}), "e30"} {
+		_, err := decodeCursor(c)
+		assert.Equal(t, ErrInvalidCursor, err, c)
+	}
+
+	b := testBehavior()
+	_, err := b.GetAllAttachJoinData(ctx, Page{Cursor: "invalid!"})
+	assert.Equal(t, ErrInvalidCursor, err)
+	_, err = b.GetAllAttachJoinData(ctx, Page{Cursor: encodeCursor(cursor{ID: 1})})
+	assert.Equal(t, nil, err)
+}
@@ -0,0 +1,297 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/SeijiOmi/posts-service/repository"
+)
+
+// dateLayout 作成日で絞り込む場合の日付の形式
+const dateLayout = "2006-01-02"
+
+// sortNames クエリで指定する並び順の名前
+var sortNames = map[repository.Sort]string{
+	repository.SortNewest:    "newest",
+	repository.SortOldest:    "oldest",
+	repository.SortPoint:     "point",
+	repository.SortRelevance: "relevance",
+}
+
+// PostField 投稿情報の検索に使用できる項目
+type PostField int
+
+const (
+	// FieldUserID 投稿者のユーザーID
+	FieldUserID PostField = iota + 1
+	// FieldHelperUserID ヘルパーのユーザーID
+	FieldHelperUserID
+)
+
+// postFieldNames 項目の名前。ParsePostFieldで受け付けるのはここにある名前のみ。
+var postFieldNames = map[PostField]string{
+	FieldUserID:       "user_id",
+	FieldHelperUserID: "helper_user_id",
+}
+
+// ErrUnknownField 検索に使用できない項目が指定された。
+var ErrUnknownField = errors.New("unknown post field")
+
+// ParsePostField 項目の名前からPostFieldを取得する。未知の名前の場合はErrUnknownFieldを返却する。
+func ParsePostField(name string) (PostField, error) {
+	for field, n := range postFieldNames {
+		if n == name {
+			return field, nil
+		}
+	}
+	return 0, ErrUnknownField
+}
+
+// String 項目の名前を返却する。
+func (f PostField) String() string {
+	if name, ok := postFieldNames[f]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// InvalidFilterError 絞り込み条件の指定が不正な場合のエラー
+type InvalidFilterError struct {
+	Param string
+	Value string
+}
+
+func (e *InvalidFilterError) Error() string {
+	return "invalid filter " + e.Param + ": " + e.Value
+}
+
+// PostQuery 投稿情報一覧の絞り込み条件と並び順を組み立てる。
+// 各メソッドは条件を追加して自身を返却するため、続けて呼び出せる。
+type PostQuery struct {
+	filter repository.PostFilter
+}
+
+// NewPostQuery 全ての投稿情報を新しい順に取得する条件を生成する。
+func NewPostQuery() *PostQuery {
+	return &PostQuery{}
+}
+
+// Search 本文にtextのいずれかの語を含む投稿情報に絞り込み、関連度の高い順に並べる。
+// 並び順はSortByで変更できる。
+func (q *PostQuery) Search(text string) *PostQuery {
+	q.filter.Text = strings.TrimSpace(text)
+	q.filter.Sort = repository.SortRelevance
+	return q
+}
+
+// Status いずれかの状態の投稿情報に絞り込む。
+func (q *PostQuery) Status(statuses ...entity.Status) *PostQuery {
+	q.filter.Statuses = append(q.filter.Statuses, statuses...)
+	return q
+}
+
+// MinPoint ポイントがpoint以上の投稿情報に絞り込む。
+func (q *PostQuery) MinPoint(point uint) *PostQuery {
+	q.filter.MinPoint = &point
+	return q
+}
+
+// MaxPoint ポイントがpoint以下の投稿情報に絞り込む。
+func (q *PostQuery) MaxPoint(point uint) *PostQuery {
+	q.filter.MaxPoint = &point
+	return q
+}
+
+// AnyTags いずれかのタグが付いた投稿情報に絞り込む。
+func (q *PostQuery) AnyTags(tagIDs ...uint) *PostQuery {
+	q.filter.TagIDs = append(q.filter.TagIDs, tagIDs...)
+	q.filter.AllTags = false
+	return q
+}
+
+// AllTags 全てのタグが付いた投稿情報に絞り込む。
+func (q *PostQuery) AllTags(tagIDs ...uint) *PostQuery {
+	q.filter.TagIDs = append(q.filter.TagIDs, tagIDs...)
+	q.filter.AllTags = true
+	return q
+}
+
+// Owner ユーザーが投稿した投稿情報に絞り込む。
+func (q *PostQuery) Owner(userID uint) *PostQuery {
+	q.filter.UserID = &userID
+	return q
+}
+
+// Helper ユーザーがヘルパーの投稿情報に絞り込む。
+func (q *PostQuery) Helper(userID uint) *PostQuery {
+	q.filter.HelperUserID = &userID
+	return q
+}
+
+// NoHelper ヘルパーが決まっていない投稿情報に絞り込む。
+func (q *PostQuery) NoHelper() *PostQuery {
+	return q.Helper(0)
+}
+
+// CreatedFrom from以降に作成された投稿情報に絞り込む。
+func (q *PostQuery) CreatedFrom(from time.Time) *PostQuery {
+	q.filter.CreatedFrom = &from
+	return q
+}
+
+// CreatedBefore beforeより前に作成された投稿情報に絞り込む。
+func (q *PostQuery) CreatedBefore(before time.Time) *PostQuery {
+	q.filter.CreatedBefore = &before
+	return q
+}
+
+// Where 項目の値が一致する投稿情報に絞り込む。未知の項目の場合はErrUnknownFieldを返却する。
+func (q *PostQuery) Where(field PostField, value uint) (*PostQuery, error) {
+	switch field {
+	case FieldUserID:
+		return q.Owner(value), nil
+	case FieldHelperUserID:
+		return q.Helper(value), nil
+	}
+	return q, ErrUnknownField
+}
+
+// SortBy 並び順を指定する。
+func (q *PostQuery) SortBy(sort repository.Sort) *PostQuery {
+	q.filter.Sort = sort
+	return q
+}
+
+// ParsePostQuery GET /postsのクエリパラメータから絞り込み条件を生成する。
+// status・tag_idはカンマ区切りまたは複数回指定できる。created_from・created_toはYYYY-MM-DD形式で、指定した日を含む。
+// qを指定した場合は本文を全文検索し、sortの既定を関連度順とする。
+func ParsePostQuery(values url.Values) (*PostQuery, error) {
+	q := NewPostQuery()
+
+	if text := strings.TrimSpace(values.Get("q")); text != "" {
+		q.Search(text)
+	}
+
+	for _, name := range splitValues(values["status"]) {
+		status, ok := entity.ParseStatus(name)
+		if !ok {
+			return nil, &InvalidFilterError{Param: "status", Value: name}
+		}
+		q.Status(status)
+	}
+
+	if value := values.Get("min_point"); value != "" {
+		point, err := parseUint("min_point", value)
+		if err != nil {
+			return nil, err
+		}
+		q.MinPoint(point)
+	}
+	if value := values.Get("max_point"); value != "" {
+		point, err := parseUint("max_point", value)
+		if err != nil {
+			return nil, err
+		}
+		q.MaxPoint(point)
+	}
+
+	var tagIDs []uint
+	for _, value := range splitValues(values["tag_id"]) {
+		id, err := parseUint("tag_id", value)
+		if err != nil {
+			return nil, err
+		}
+		tagIDs = append(tagIDs, id)
+	}
+	switch match := values.Get("tag_match"); match {
+	case "", "any":
+		q.AnyTags(tagIDs...)
+	case "all":
+		q.AllTags(tagIDs...)
+	default:
+		return nil, &InvalidFilterError{Param: "tag_match", Value: match}
+	}
+
+	if value := values.Get("user_id"); value != "" {
+		id, err := parseUint("user_id", value)
+		if err != nil {
+			return nil, err
+		}
+		q.Owner(id)
+	}
+	if value := values.Get("helper_user_id"); value != "" {
+		id, err := parseUint("helper_user_id", value)
+		if err != nil {
+			return nil, err
+		}
+		q.Helper(id)
+	}
+	if value := values.Get("no_helper"); value != "" {
+		noHelper, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, &InvalidFilterError{Param: "no_helper", Value: value}
+		}
+		if noHelper {
+			q.NoHelper()
+		}
+	}
+
+	if value := values.Get("created_from"); value != "" {
+		from, err := time.ParseInLocation(dateLayout, value, time.Local)
+		if err != nil {
+			return nil, &InvalidFilterError{Param: "created_from", Value: value}
+		}
+		q.CreatedFrom(from)
+	}
+	if value := values.Get("created_to"); value != "" {
+		to, err := time.ParseInLocation(dateLayout, value, time.Local)
+		if err != nil {
+			return nil, &InvalidFilterError{Param: "created_to", Value: value}
+		}
+		q.CreatedBefore(to.AddDate(0, 0, 1))
+	}
+
+	if value := values.Get("sort"); value != "" {
+		sort, ok := parseSort(value)
+		if !ok || sort == repository.SortRelevance && q.filter.Text == "" {
+			return nil, &InvalidFilterError{Param: "sort", Value: value}
+		}
+		q.SortBy(sort)
+	}
+
+	return q, nil
+}
+
+func parseSort(name string) (repository.Sort, bool) {
+	for sort, n := range sortNames {
+		if n == name {
+			return sort, true
+		}
+	}
+	return 0, false
+}
+
+func parseUint(param string, value string) (uint, error) {
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, &InvalidFilterError{Param: param, Value: value}
+	}
+	return uint(n), nil
+}
+
+// splitValues 複数回指定・カンマ区切りの値を1つの一覧にする。
+func splitValues(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				result = append(result, v)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/SeijiOmi/posts-service/repository"
+)
+
+func postIDsOf(page entity.PostPage) []uint {
+	ids := []uint{}
+	for _, item := range page.Items {
+		ids = append(ids, item.Post.ID)
+	}
+	return ids
+}
+
+func createPointPost(userID uint, helperUserID uint, point uint, status entity.Status) entity.Post {
+	post := createStatusPost(0, userID, helperUserID, status)
+	post.Point = point
+	testStore.Posts().Save(&post)
+	return post
+}
+
+func TestFindAttachJoinDataFilter(t *testing.T) {
+	initTable()
+	p1 := createPointPost(1, 0, 100, entity.Open)
+	p2 := createPointPost(1, 2, 300, entity.Matched)
+	p3 := createPointPost(2, 0, 500, entity.Open)
+	p4 := createPointPost(2, 1, 200, entity.Paid)
+
+	tagA := createBodyTag("a")
+	tagB := createBodyTag("b")
+	createTestPostTag(p1.ID, tagA.ID)
+	createTestPostTag(p2.ID, tagA.ID)
+	createTestPostTag(p2.ID, tagB.ID)
+	createTestPostTag(p3.ID, tagB.ID)
+
+	cases := []struct {
+		name  string
+		query *PostQuery
+		ids   []uint
+	}{
+		{"all", NewPostQuery(), []uint{p4.ID, p3.ID, p2.ID, p1.ID}},
+		{"status", NewPostQuery().Status(entity.Open, entity.Paid), []uint{p4.ID, p3.ID, p1.ID}},
+		{"point", NewPostQuery().MinPoint(200).MaxPoint(300), []uint{p4.ID, p2.ID}},
+		{"owner", NewPostQuery().Owner(1), []uint{p2.ID, p1.ID}},
+		{"helper", NewPostQuery().Helper(1), []uint{p4.ID}},
+		{"no helper", NewPostQuery().NoHelper(), []uint{p3.ID, p1.ID}},
+		{"any tags", NewPostQuery().AnyTags(tagA.ID, tagB.ID), []uint{p3.ID, p2.ID, p1.ID}},
+		{"all tags", NewPostQuery().AllTags(tagA.ID, tagB.ID), []uint{p2.ID}},
+		{"combined", NewPostQuery().AnyTags(tagB.ID).NoHelper().MinPoint(100), []uint{p3.ID}},
+		{"oldest", NewPostQuery().Owner(2).SortBy(repository.SortOldest), []uint{p3.ID, p4.ID}},
+		{"point sort", NewPostQuery().SortBy(repository.SortPoint), []uint{p3.ID, p2.ID, p4.ID, p1.ID}},
+	}
+
+	b := testBehavior()
+	for _, c := range cases {
+		page, err := b.FindAttachJoinData(ctx, c.query, Page{})
+		assert.Equal(t, nil, err, c.name)
+		assert.Equal(t, c.ids, postIDsOf(page), c.name)
+	}
+}
+
+func TestFindAttachJoinDataCreatedRange(t *testing.T) {
+	initTable()
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		post := postDefault
+		post.UserID = 1
+		post.CreatedAt = day.AddDate(0, 0, i).Add(12 * time.Hour)
+		testStore.Posts().Create(&post)
+	}
+
+	query, err := ParsePostQuery(url.Values{"created_from": {"2026-10-02"}, "created_to": {"2026-10-02"}})
+	assert.Equal(t, nil, err)
+
+	b := testBehavior()
+	page, err := b.FindAttachJoinData(ctx, query, Page{})
+	assert.Equal(t, nil, err)
+	// created_toに指定した日も含む。
+	assert.Equal(t, []uint{2}, postIDsOf(page))
+}
+
+func TestFindAttachJoinDataPointCursor(t *testing.T) {
+	initTable()
+	for _, point := range []uint{100, 300, 300, 200, 300} {
+		createPointPost(1, 0, point, entity.Open)
+	}
+
+	b := testBehavior()
+	query := NewPostQuery().SortBy(repository.SortPoint)
+	ids := []uint{}
+	page := Page{Limit: 2}
+	for {
+		result, err := b.FindAttachJoinData(ctx, query, page)
+		assert.Equal(t, nil, err)
+		ids = append(ids, postIDsOf(result)...)
+		if !result.HasMore {
+			break
+		}
+		page.Cursor = result.NextCursor
+	}
+
+	// 同じポイントの投稿がページをまたいでも重複・欠落しない。
+	assert.Equal(t, []uint{5, 3, 2, 4, 1}, ids)
+
+	// 並び順の異なるcursorは使用できない。
+	first, _ := b.FindAttachJoinData(ctx, query, Page{Limit: 2})
+	_, err := b.FindAttachJoinData(ctx, NewPostQuery(), Page{Cursor: first.NextCursor})
+	assert.Equal(t, ErrInvalidCursor, err)
+}
+
+func TestParsePostQuery(t *testing.T) {
+	query, err := ParsePostQuery(url.Values{
+		"status":    {"open,matched"},
+		"tag_id":    {"1", "2"},
+		"tag_match": {"all"},
+		"no_helper": {"true"},
+		"sort":      {"point"},
+	})
+	assert.Equal(t, nil, err)
+	helper := uint(0)
+	assert.Equal(t, repository.PostFilter{
+		Statuses:     []entity.Status{entity.Open, entity.Matched},
+		HelperUserID: &helper,
+		TagIDs:       []uint{1, 2},
+		AllTags:      true,
+		Sort:         repository.SortPoint,
+	}, query.filter)
+
+	invalid := []url.Values{
+		{"status": {"unknown"}},
+		{"min_point": {"-1"}},
+		{"tag_id": {"a"}},
+		{"tag_match": {"some"}},
+		{"user_id": {"x"}},
+		{"no_helper": {"maybe"}},
+		{"created_from": {"2026/10/01"}},
+		{"sort": {"random"}},
+	}
+	for _, values := range invalid {
+		_, err := ParsePostQuery(values)
+		_, ok := err.(*InvalidFilterError)
+		assert.True(t, ok, values.Encode())
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+func createBodyPost(body string, status entity.Status) entity.Post {
+	post := createStatusPost(0, 1, 0, status)
+	post.Body = body
+	testStore.Posts().Save(&post)
+	return post
+}
+
+func TestSearchAttachJoinData(t *testing.T) {
+	initTable()
+	once := createBodyPost("庭の草むしりをお願いします", entity.Open)
+	twice := createBodyPost("草むしりと庭木の草むしり", entity.Open)
+	shopping := createBodyPost("買い物の手伝い", entity.Open)
+	closed := createBodyPost("草むしり", entity.Cancelled)
+
+	b := testBehavior()
+	query, _ := ParsePostQuery(url.Values{"q": {"草むしり"}})
+	page, err := b.SearchAttachJoinData(ctx, query, Page{})
+	assert.Equal(t, nil, err)
+	// 多く含むほど関連度が高い。関連度が同じ場合は新しい順。
+	assert.Equal(t, []uint{twice.ID, closed.ID, once.ID}, postIDsOf(page))
+
+	query, _ = ParsePostQuery(url.Values{"q": {"草むしり"}, "status": {"open"}})
+	page, err = b.SearchAttachJoinData(ctx, query, Page{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []uint{twice.ID, once.ID}, postIDsOf(page))
+
+	// 空白で区切った語のいずれかを含む投稿情報に一致する。
+	query, _ = ParsePostQuery(url.Values{"q": {"買い物 庭木"}, "sort": {"oldest"}})
+	page, err = b.SearchAttachJoinData(ctx, query, Page{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []uint{twice.ID, shopping.ID}, postIDsOf(page))
+}
+
+func TestSearchAttachJoinDataCursor(t *testing.T) {
+	initTable()
+	for i := 0; i < 5; i++ {
+		createBodyPost("草むしり", entity.Open)
+	}
+	createBodyPost("買い物", entity.Open)
+
+	b := testBehavior()
+	query := NewPostQuery().Search("草むしり")
+	ids := []uint{}
+	page := Page{Limit: 2}
+	for {
+		result, err := b.SearchAttachJoinData(ctx, query, page)
+		assert.Equal(t, nil, err)
+		ids = append(ids, postIDsOf(result)...)
+		if !result.HasMore {
+			break
+		}
+		page.Cursor = result.NextCursor
+	}
+	assert.Equal(t, []uint{5, 4, 3, 2, 1}, ids)
+}
+
+func TestSearchAttachJoinDataNoText(t *testing.T) {
+	b := testBehavior()
+	_, err := b.SearchAttachJoinData(ctx, NewPostQuery(), Page{})
+	_, ok := err.(*InvalidFilterError)
+	assert.True(t, ok)
+
+	_, err = ParsePostQuery(url.Values{"sort": {"relevance"}})
+	_, ok = err.(*InvalidFilterError)
+	assert.True(t, ok)
+}
@@ -1,473 +1,607 @@
 package service
 
 import (
+	"context"
 	"errors"
-	"net/http"
-	"os"
+	"fmt"
 	"strconv"
+	"time"
 
-	"github.com/SeijiOmi/posts-service/db"
+	"github.com/SeijiOmi/posts-service/client"
 	"github.com/SeijiOmi/posts-service/entity"
-	"github.com/jmcvetta/napping"
+	"github.com/SeijiOmi/posts-service/repository"
 )
 
 // Behavior 投稿サービスを提供するメソッド群
-type Behavior struct{}
+type Behavior struct {
+	Store  repository.Store
+	Users  client.UserDirectory
+	Points client.PointLedger
+	// TagNormalizer タグの照合方法。ゼロ値の場合はひらがな・カタカナを区別する。
+	TagNormalizer TagNormalizer
+	// Verifier nil以外の場合はユーザーサービスへ問い合わせずにトークンを検証する。
+	Verifier *JWTVerifier
+	// AdminUserIDs タグの管理など管理者のみ可能な操作を行えるユーザー。空の場合は誰も行えない。
+	AdminUserIDs map[int]bool
+
+	trending *trendingCache
+	suggest  *tagSuggester
+}
+
+// NewBehavior 永続化先と外部サービスのクライアントを指定してBehaviorを生成する。
+func NewBehavior(store repository.Store, users client.UserDirectory, points client.PointLedger) Behavior {
+	return Behavior{Store: store, Users: users, Points: points, trending: newTrendingCache(), suggest: newTagSuggester()}
+}
 
 var limit = 40
 
 // GetAll 投稿全件を取得
 func (b Behavior) GetAll(offset int) ([]entity.Post, error) {
-	db := db.GetDB()
-	var post []entity.Post
-
-	if err := db.Offset(offset).Limit(limit).Order("id desc").Find(&post).Error; err != nil {
-		return nil, err
-	}
-
-	return post, nil
+	return b.Store.Posts().Find(repository.PostFilter{}, repository.Page{Offset: offset, Limit: limit})
 }
 
 // GetAllAttachJoinData 投稿情報にユーザ情報を紐づけて取得
-func (b Behavior) GetAllAttachJoinData(offset int) ([]entity.JoinPost, error) {
-	posts, err := b.GetAll(offset)
-	if err != nil {
-		return nil, err
-	}
-
-	return attachJoinData(posts)
+func (b Behavior) GetAllAttachJoinData(ctx context.Context, page Page) (entity.PostPage, error) {
+	return b.FindAttachJoinData(ctx, NewPostQuery(), page)
 }
 
-// FindByColumn 指定されたカラムで検索を行う。
-func (b Behavior) FindByColumn(column string, id string, offset int) ([]entity.Post, error) {
-	db := db.GetDB()
-	var post []entity.Post
+// FindAttachJoinData 条件に一致する投稿情報にユーザ情報を紐づけて取得
+func (b Behavior) FindAttachJoinData(ctx context.Context, query *PostQuery, page Page) (entity.PostPage, error) {
+	return b.attachJoinDataPage(ctx, query, page)
+}
 
-	if err := db.Offset(offset).Limit(limit).Where(column+" = ?", id).Order("id desc").Find(&post).Error; err != nil {
-		return post, err
+// SearchAttachJoinData 本文を全文検索し、投稿情報にユーザ情報を紐づけて取得
+// queryに検索語(Search)が指定されていない場合はInvalidFilterErrorを返却する。
+func (b Behavior) SearchAttachJoinData(ctx context.Context, query *PostQuery, page Page) (entity.PostPage, error) {
+	if query.filter.Text == "" {
+		return entity.PostPage{}, &InvalidFilterError{Param: "q"}
 	}
+	return b.attachJoinDataPage(ctx, query, page)
+}
 
-	return post, nil
+// FindByField 指定された項目の値で検索を行う。
+func (b Behavior) FindByField(field PostField, value uint, offset int) ([]entity.Post, error) {
+	query, err := NewPostQuery().Where(field, value)
+	if err != nil {
+		return nil, err
+	}
+	return b.Store.Posts().Find(query.filter, repository.Page{Offset: offset, Limit: limit})
 }
 
 // GetByHelperUserIDAttachJoinData 投稿情報にユーザ情報を紐づけて取得（ヘルパーユーザーIDで検索）
-func (b Behavior) GetByHelperUserIDAttachJoinData(userID string, offset int) ([]entity.JoinPost, error) {
-	posts, err := b.FindByColumn("helper_user_id", userID, offset)
+func (b Behavior) GetByHelperUserIDAttachJoinData(ctx context.Context, userID string, page Page) (entity.PostPage, error) {
+	id, err := strconv.Atoi(userID)
 	if err != nil {
-		return nil, err
+		return entity.PostPage{}, err
 	}
 
-	return attachJoinData(posts)
+	return b.attachJoinDataPage(ctx, NewPostQuery().Helper(uint(id)), page)
 }
 
 // GetByUserIDAttachJoinData 投稿情報にユーザ情報を紐づけて取得（ユーザーIDで検索）
-func (b Behavior) GetByUserIDAttachJoinData(userID string, offset int) ([]entity.JoinPost, error) {
-	posts, err := b.FindByColumn("user_id", userID, offset)
+func (b Behavior) GetByUserIDAttachJoinData(ctx context.Context, userID string, page Page) (entity.PostPage, error) {
+	id, err := strconv.Atoi(userID)
 	if err != nil {
-		return nil, err
+		return entity.PostPage{}, err
 	}
 
-	return attachJoinData(posts)
+	return b.attachJoinDataPage(ctx, NewPostQuery().Owner(uint(id)), page)
 }
 
 // GetByTagIDAttachJoinData タグＩＤで投稿情報を検索する。（ヘルパーユーザーIDで検索）
-func (b Behavior) GetByTagIDAttachJoinData(tagID string, offset int) ([]entity.JoinPost, error) {
-	db := db.GetDB()
-	rows, err := db.Table("posts").
-		Offset(offset).
-		Limit(limit).
-		Select("distinct posts.*").
-		Joins("inner join post_tags on posts.id = post_tags.post_id").
-		Where("post_tags.tag_id = ?", tagID).
-		Rows()
-	defer rows.Close()
+func (b Behavior) GetByTagIDAttachJoinData(ctx context.Context, tagID string, page Page) (entity.PostPage, error) {
+	id, err := strconv.Atoi(tagID)
 	if err != nil {
-		return []entity.JoinPost{}, err
+		return entity.PostPage{}, err
 	}
 
-	var posts []entity.Post
-	for rows.Next() {
-		var post entity.Post
-		db.ScanRows(rows, &post)
-		posts = append(posts, post)
-	}
-
-	return attachJoinData(posts)
+	return b.attachJoinDataPage(ctx, NewPostQuery().AnyTags(uint(id)), page)
 }
 
 // CreateModel 投稿情報の生成
-func (b Behavior) CreateModel(inputPost entity.JoinPost, token string) (entity.JoinPost, error) {
-	userID, err := getUserIDByToken(token)
+func (b Behavior) CreateModel(ctx context.Context, inputPost entity.JoinPost, user entity.AuthUser) (entity.JoinPost, error) {
+	createPost := inputPost.Post
+	// IDは保存時に採番する。取り消した投稿のIDを再利用するとエスクローや履歴が混ざるため、指定を無視する。
+	createPost.ID = 0
+	createPost.UserID = uint(user.ID)
+	// 新規投稿は必ずヘルパー募集中から開始する。
+	createPost.HelperUserID = 0
+	createPost.Status = entity.Open
+	// 作成日時は保存時に設定する。
+	createPost.CreatedAt = time.Time{}
+
+	balance, err := b.Points.Total(ctx, user.ID)
 	if err != nil {
 		return entity.JoinPost{}, err
 	}
-	createPost := inputPost.Post
-	createPost.UserID = uint(userID)
 
-	tx := db.StartBegin()
+	err = b.Store.Transaction(func(tx repository.Store) error {
+		if err := tx.LockUser(createPost.UserID); err != nil {
+			return err
+		}
 
-	if err := tx.Create(&createPost).Error; err != nil {
-		db.EndRollback()
-		return entity.JoinPost{}, err
-	}
+		if err := checkBalance(tx, createPost.UserID, 0, createPost.Point, balance); err != nil {
+			return err
+		}
 
-	for _, inputTag := range inputPost.Tags {
-		tag, err := createTagModel(inputTag)
-		if err != nil {
-			db.EndRollback()
-			return entity.JoinPost{}, err
+		if err := tx.Posts().Create(&createPost); err != nil {
+			return err
 		}
 
-		err = createPostTagModel(createPost.ID, tag.ID)
-		if err != nil {
-			db.EndRollback()
-			return entity.JoinPost{}, err
+		if err := applyEscrow(tx, createPost, EventCreate); err != nil {
+			return err
 		}
+
+		if err := replacePostTags(tx, b.TagNormalizer, createPost.ID, inputPost.Tags, false); err != nil {
+			return err
+		}
+
+		return createPostEvent(tx, createPost, EventCreate, entity.Open, user.ID)
+	})
+	if err != nil {
+		return entity.JoinPost{}, err
 	}
 
-	db.EndCommit()
-	return attachJoinDataSingle(createPost)
+	return b.attachJoinDataSingle(ctx, createPost)
 }
 
-// SetHelpUserID 投稿情報のHlpUserIDにTokenから取得したユーザＩＤを格納する。
-func (b Behavior) SetHelpUserID(id string, token string) (entity.JoinPost, error) {
-	findPost, userID, err := authAndGetPost(id, token)
+// SetHelpUserID 投稿情報のHlpUserIDにリクエストユーザーのＩＤを格納する。
+func (b Behavior) SetHelpUserID(ctx context.Context, id string, user entity.AuthUser) (entity.JoinPost, error) {
+	postID, err := parsePostID(id)
 	if err != nil {
 		return entity.JoinPost{}, err
 	}
 
-	findPost.HelperUserID = uint(userID)
+	var post entity.Post
+	err = b.Store.Transaction(func(tx repository.Store) error {
+		var from entity.Status
+		post, from, err = lockPost(tx, postID, user, EventMatch)
+		if err != nil {
+			return err
+		}
+		post.HelperUserID = uint(user.ID)
 
-	post, err := updatePostExec(&findPost)
+		return savePostChange(tx, &post, EventMatch, from, user.ID, nil)
+	})
 	if err != nil {
 		return entity.JoinPost{}, err
 	}
 
-	return attachJoinDataSingle(post)
+	return b.attachJoinDataSingle(ctx, post)
 }
 
 // TakeHelpUserID 投稿情報のHlpUserIDにTokenから取得したユーザＩＤを格納する。
-func (b Behavior) TakeHelpUserID(id string, token string) (entity.JoinPost, error) {
-	findPost, _, err := authAndGetPost(id, token)
+func (b Behavior) TakeHelpUserID(ctx context.Context, id string, user entity.AuthUser) (entity.JoinPost, error) {
+	postID, err := parsePostID(id)
 	if err != nil {
 		return entity.JoinPost{}, err
 	}
-	findPost.HelperUserID = 0
 
-	post, err := updatePostExec(&findPost)
+	var post entity.Post
+	err = b.Store.Transaction(func(tx repository.Store) error {
+		var from entity.Status
+		post, from, err = lockPost(tx, postID, user, EventUnmatch)
+		if err != nil {
+			return err
+		}
+		post.HelperUserID = 0
+
+		return savePostChange(tx, &post, EventUnmatch, from, user.ID, nil)
+	})
 	if err != nil {
 		return entity.JoinPost{}, err
 	}
 
-	return attachJoinDataSingle(post)
+	return b.attachJoinDataSingle(ctx, post)
 }
 
 // DonePayment 投稿情報を元に完了ステータスの登録とポイントの支払をする。
-func (b Behavior) DonePayment(id string, token string) (entity.JoinPost, error) {
-	findPost, _, err := authAndGetPost(id, token)
+func (b Behavior) DonePayment(ctx context.Context, id string, user entity.AuthUser) (entity.JoinPost, error) {
+	findPost, err := b.GetByID(id)
 	if err != nil {
 		return entity.JoinPost{}, err
 	}
 
-	if findPost.HelperUserID == 0 {
-		return entity.JoinPost{}, errors.New("PostID:" + strconv.Itoa(int(findPost.ID)) + " Don't have helper")
-	}
-
-	findPost.Status = entity.Payment
-
-	post, err := updatePostExec(&findPost)
+	// コメントに使うユーザー名はトランザクションの外で取得する。
+	joinPost, err := b.attachJoinDataSingle(ctx, findPost)
 	if err != nil {
 		return entity.JoinPost{}, err
 	}
 
-	JoinPost, err := attachJoinDataSingle(post)
-	if err != nil {
-		return entity.JoinPost{}, err
+	// コメントは精算とともに保存されるため、ヘルパーの名前が取得できない場合は精算しない。
+	if joinPost.HelperUser.Unresolved {
+		return entity.JoinPost{}, ErrSettlementUserUnresolved
 	}
 
 	// ポイント支払いのため、マイナスポイントを登録する。
-	comment := JoinPost.HelperUser.Name + "さんが助けてくれました！"
-	createPoint(-int(findPost.Point), comment, token)
+	comment := joinPost.HelperUser.Name + "さんが助けてくれました！"
+	settlement, err := b.settlePost(findPost, user, EventPay, -1, comment)
+	if err != nil {
+		return entity.JoinPost{}, err
+	}
+	b.deliverSettlement(ctx, settlement)
 
-	return JoinPost, nil
+	joinPost.Post, err = b.Store.Posts().FindByID(findPost.ID)
+	return joinPost, err
 }
 
 // DoneAcceptance 投稿情報のHlpUserIDにTokenから取得したユーザＩＤを格納する。
-func (b Behavior) DoneAcceptance(id string, token string) (entity.JoinPost, error) {
-	findPost, _, err := authAndGetPost(id, token)
+func (b Behavior) DoneAcceptance(ctx context.Context, id string, user entity.AuthUser) (entity.JoinPost, error) {
+	findPost, err := b.GetByID(id)
 	if err != nil {
 		return entity.JoinPost{}, err
 	}
 
-	if findPost.Status != entity.Payment {
-		return entity.JoinPost{}, errors.New("PostID:" + strconv.Itoa(int(findPost.ID)) + " Status not payment")
-	}
-
-	findPost.Status = entity.Acceptance
-
-	post, err := updatePostExec(&findPost)
+	joinPost, err := b.attachJoinDataSingle(ctx, findPost)
 	if err != nil {
 		return entity.JoinPost{}, err
 	}
 
-	JoinPost, err := attachJoinDataSingle(post)
+	if joinPost.User.Unresolved {
+		return entity.JoinPost{}, ErrSettlementUserUnresolved
+	}
+
+	comment := joinPost.User.Name + "さんを助けました！"
+	settlement, err := b.settlePost(findPost, user, EventAccept, 1, comment)
 	if err != nil {
 		return entity.JoinPost{}, err
 	}
+	b.deliverSettlement(ctx, settlement)
 
-	comment := JoinPost.User.Name + "さんを助けました！"
-	createPoint(int(findPost.Point), comment, token)
-
-	return JoinPost, nil
+	joinPost.Post, err = b.Store.Posts().FindByID(findPost.ID)
+	return joinPost, err
 }
 
-// GetByID IDを元に投稿1件を取得
-func (b Behavior) GetByID(id string) (entity.Post, error) {
-	db := db.GetDB()
-	var u entity.Post
+// settlePost 投稿情報を行ロックして状態を遷移させ、ポイント精算を登録する。
+// 精算のポイントは行ロック後の投稿情報のポイントにsignを掛けた値とする。
+// commentを作成した時点(findPost)からヘルパーが変わっていた場合はErrPostChangedを返却する。
+func (b Behavior) settlePost(findPost entity.Post, user entity.AuthUser, event Event, sign int, comment string) (entity.Settlement, error) {
+	var settlement entity.Settlement
+	err := b.Store.Transaction(func(tx repository.Store) error {
+		post, from, err := lockPost(tx, findPost.ID, user, event)
+		if err != nil {
+			return err
+		}
+		if post.HelperUserID != findPost.HelperUserID {
+			return ErrPostChanged
+		}
 
-	if err := db.Where("id = ?", id).First(&u).Error; err != nil {
-		return u, err
-	}
+		settlement = newSettlement(post, event, user, sign*int(post.Point), comment)
+		return savePostChange(tx, &post, event, from, user.ID, &settlement)
+	})
 
-	return u, nil
+	return settlement, err
 }
 
-// UpdateByID 指定されたidをinputPost通りに更新
-func (b Behavior) UpdateByID(id string, inputPost entity.Post) (entity.Post, error) {
-	findPost, err := b.GetByID(id)
-	if err != nil {
-		return findPost, err
+// Authenticate トークンを検証し、リクエストユーザーを取得する。
+// トークンが空・無効な場合はclient.ErrInvalidTokenを返却する。それ以外のエラーはユーザーサービスの障害による。
+func (b Behavior) Authenticate(ctx context.Context, token string) (entity.AuthUser, error) {
+	if token == "" {
+		return entity.AuthUser{}, fmt.Errorf("%w: token empty", client.ErrInvalidToken)
 	}
 
-	updatePostData := inputPost
-	updatePostData.ID = findPost.ID
+	userID, err := b.userIDByToken(ctx, token)
+	if err != nil {
+		return entity.AuthUser{}, err
+	}
 
-	return updatePostExec(&updatePostData)
+	return entity.AuthUser{ID: userID, Token: token}, nil
 }
 
-// DeleteByID 指定されたidを削除
-func (b Behavior) DeleteByID(id string) error {
-	db := db.GetDB()
-	var u entity.Post
-
-	if err := db.Where("id = ?", id).Delete(&u).Error; err != nil {
-		return err
+// GetByID IDを元に投稿1件を取得
+func (b Behavior) GetByID(id string) (entity.Post, error) {
+	postID, err := parsePostID(id)
+	if err != nil {
+		return entity.Post{}, err
 	}
 
-	return nil
+	return b.Store.Posts().FindByID(postID)
 }
 
-// GetAmountPaymentByUserID 現在の支払い可能ポイントを取得する。
-func (b Behavior) GetAmountPaymentByUserID(id string) (int, error) {
-	havePoint, err := getPointByUserID(id)
+func parsePostID(id string) (uint, error) {
+	postID, err := strconv.Atoi(id)
 	if err != nil {
 		return 0, err
 	}
+	return uint(postID), nil
+}
 
-	paymentPoint, err := getScheduledPaymentPointByUserID(id)
+// lockPost 投稿情報を行ロックして読み直し、権限と状態遷移を確認する。Transaction内で呼び出すこと。
+// 同じ投稿情報への操作はトランザクション終了まで直列化されるため、確認した状態のまま保存できる。
+// 遷移後の投稿情報と遷移前の状態を返却する。
+func lockPost(tx repository.Store, postID uint, user entity.AuthUser, event Event) (entity.Post, entity.Status, error) {
+	post, err := tx.Posts().FindByIDForUpdate(postID)
 	if err != nil {
-		return 0, err
+		return post, 0, err
 	}
 
-	amountPayment := havePoint - paymentPoint
-	return amountPayment, nil
-}
+	if err := authorize(post, user.ID, event); err != nil {
+		return post, 0, err
+	}
 
-func createTagModel(inputTag entity.Tag) (entity.Tag, error) {
-	db := db.GetDB()
-	createTag := inputTag
+	from, err := transition(&post, event)
+	return post, from, err
+}
 
-	// 既に存在するタグの場合そのデータを返却する。
-	tag, _ := getTagByBody(createTag.Body)
-	empty := entity.Tag{}
-	if tag != empty {
-		return tag, nil
+// UpdateByID 指定されたidをinput通りに更新（投稿者のみ）
+func (b Behavior) UpdateByID(ctx context.Context, id string, input entity.PostUpdate, user entity.AuthUser) (entity.Post, error) {
+	postID, err := parsePostID(id)
+	if err != nil {
+		return entity.Post{}, err
 	}
 
-	if err := db.Create(&createTag).Error; err != nil {
-		return createTag, err
+	// ポイントを変更する場合は支払可能ポイントを超えないか確認するため、保有ポイントを先に取得する。
+	var balance int
+	if input.Point != nil {
+		if balance, err = b.Points.Total(ctx, user.ID); err != nil {
+			return entity.Post{}, err
+		}
 	}
 
-	return createTag, nil
-}
-
-// FindTagLikeBody Tag.BodyをLike検索する。
-func (b Behavior) FindTagLikeBody(body string) ([]entity.Tag, error) {
-	db := db.GetDB()
-	var tags []entity.Tag
+	var post entity.Post
+	err = b.Store.Transaction(func(tx repository.Store) error {
+		// 投稿者のユーザーロックを投稿情報の行ロックより先に取得する。
+		// 投稿者以外の場合は、lockPostの権限確認で拒否される。
+		if input.Point != nil {
+			if err := tx.LockUser(uint(user.ID)); err != nil {
+				return err
+			}
+		}
 
-	if err := db.Where("body LIKE ?", "%"+body+"%").Find(&tags).Error; err != nil {
-		return []entity.Tag{}, err
-	}
+		var from entity.Status
+		post, from, err = lockPost(tx, postID, user, EventEdit)
+		if err != nil {
+			return err
+		}
 
-	return tags, nil
-}
+		if input.Body != nil {
+			post.Body = *input.Body
+		}
+		if input.Point != nil {
+			increase := *input.Point > post.Point
+			post.Point = *input.Point
+			if increase {
+				if err := checkBalance(tx, post.UserID, post.ID, post.Point, balance); err != nil {
+					return err
+				}
+			}
+		}
 
-func getTagByBody(body string) (entity.Tag, error) {
-	db := db.GetDB()
-	var tag entity.Tag
+		if err := savePostChange(tx, &post, EventEdit, from, user.ID, nil); err != nil {
+			return err
+		}
 
-	if err := db.Where("body = ?", body).First(&tag).Error; err != nil {
-		return entity.Tag{}, err
-	}
+		// タグの付け替えは投稿情報の更新と同じトランザクションで行う。
+		if input.Tags == nil {
+			return nil
+		}
+		return replacePostTags(tx, b.TagNormalizer, post.ID, *input.Tags, input.PruneTags)
+	})
 
-	return tag, nil
+	return post, err
 }
 
-func createPostTagModel(postID uint, tagID uint) error {
-	db := db.GetDB()
-	createPostTag := entity.PostTag{
-		PostID: postID,
-		TagID:  tagID,
-	}
-	if err := db.Create(&createPostTag).Error; err != nil {
+// DeleteByID 指定されたidを削除（投稿者のみ）
+func (b Behavior) DeleteByID(id string, user entity.AuthUser) error {
+	postID, err := parsePostID(id)
+	if err != nil {
 		return err
 	}
 
-	return nil
-}
+	return b.Store.Transaction(func(tx repository.Store) error {
+		post, from, err := lockPost(tx, postID, user, EventCancel)
+		if err != nil {
+			return err
+		}
 
-// getScheduledPaymentPointByUserID 投稿情報ステータスがNoneのポイントの集計を行う。
-func getScheduledPaymentPointByUserID(id string) (int, error) {
-	db := db.GetDB()
+		if err := tx.Posts().Delete(post.ID); err != nil {
+			return err
+		}
 
-	rows, err := db.Table("posts").
-		Select("sum(point) as point").
-		Where("user_id = ?", id).
-		Where("status = ?", entity.None).
-		Group("user_id").Rows()
-	defer rows.Close()
+		if err := applyEscrow(tx, post, EventCancel); err != nil {
+			return err
+		}
 
-	if err != nil {
-		return 0, err
-	}
+		return createPostEvent(tx, post, EventCancel, from, user.ID)
+	})
+}
 
-	var point int
-	for rows.Next() {
-		rows.Scan(&point)
+// GetHistoryByPostID 投稿情報の状態遷移履歴を古い順に取得する。
+// 取り消し(cancel)により削除された投稿情報も履歴は取得できる。
+func (b Behavior) GetHistoryByPostID(id string) ([]entity.PostEvent, error) {
+	postID, err := parsePostID(id)
+	if err != nil {
+		return []entity.PostEvent{}, err
 	}
 
-	return point, nil
-}
-
-func getUsersData() map[int]*entity.User {
-	var response []map[string]interface{}
-	error := struct {
-		Error string
-	}{}
-	baseURL := os.Getenv("USER_URL")
-	_, err := napping.Get(baseURL+"/users", nil, &response, &error)
+	events, err := b.Store.PostEvents().FindByPostID(postID)
 	if err != nil {
-		panic(err)
+		return []entity.PostEvent{}, err
 	}
 
-	users := map[int]*entity.User{}
-	for _, val := range response {
-		floatID, ok := val["id"].(float64)
-		if !ok {
-			panic("User id no exist")
+	// 履歴が無い場合のみ、投稿情報が存在するか確認する。
+	if len(events) == 0 {
+		if _, err := b.Store.Posts().FindByID(postID); err != nil {
+			return []entity.PostEvent{}, err
 		}
-		id := int(floatID)
-		name, _ := val["name"].(string)
-		users[id] = &entity.User{ID: id, Name: name}
 	}
-	return users
+
+	return events, nil
 }
 
-func authAndGetPost(id string, token string) (entity.Post, int, error) {
-	userID, err := getUserIDByToken(token)
+// GetAmountPaymentByUserID 現在の支払い可能ポイントを取得する。
+func (b Behavior) GetAmountPaymentByUserID(ctx context.Context, id string) (int, error) {
+	balance, err := b.GetBalanceByUserID(ctx, id)
 	if err != nil {
-		return entity.Post{}, 0, err
+		return 0, err
 	}
 
-	var b Behavior
-	post, err := b.GetByID(id)
-	return post, userID, err
+	return balance.Available, nil
 }
 
-func updatePostExec(post *entity.Post) (entity.Post, error) {
-	db := db.GetDB()
-	db.Save(post)
+// GetBalanceByUserID 保有ポイント・確保中ポイント・支払可能ポイントを取得する。
+func (b Behavior) GetBalanceByUserID(ctx context.Context, id string) (entity.PointBalance, error) {
+	userID, err := strconv.Atoi(id)
+	if err != nil {
+		return entity.PointBalance{}, err
+	}
 
-	return *post, nil
-}
+	ledger, err := b.Points.Total(ctx, userID)
+	if err != nil {
+		return entity.PointBalance{}, err
+	}
 
-func getUserIDByToken(token string) (int, error) {
-	response := struct {
-		ID int
-	}{}
-	error := struct {
-		Error string
-	}{}
+	held, funded, err := escrowByUserID(b.Store, uint(userID), 0)
+	if err != nil {
+		return entity.PointBalance{}, err
+	}
 
-	baseURL := os.Getenv("USER_URL")
-	resp, err := napping.Get(baseURL+"/auth/"+token, nil, &response, &error)
+	return pointBalance(ledger, held, funded), nil
+}
 
-	if err != nil {
-		return 0, err
+// createTagModel 正規化したタグ名(slug)が一致するタグが既に存在する場合そのデータを返却する。
+// 同じタグを同時に作成しても、一意制約により1件のみ作成される。タグ名が空の場合はErrEmptyTagBodyを返却する。
+func createTagModel(tx repository.Store, normalizer TagNormalizer, inputTag entity.Tag) (entity.Tag, error) {
+	tag := entity.Tag{Body: normalizer.Body(inputTag.Body), Slug: normalizer.Slug(inputTag.Body)}
+	if tag.Slug == "" {
+		return entity.Tag{}, ErrEmptyTagBody
 	}
+	return tx.Tags().FindOrCreate(tag)
+}
 
-	if resp.Status() == http.StatusBadRequest {
-		return 0, errors.New("token invalid")
+// FindTagLikeBody 正規化したタグ名をLike検索する。
+func (b Behavior) FindTagLikeBody(body string) ([]entity.Tag, error) {
+	tags, err := b.Store.Tags().FindLikeSlug(b.TagNormalizer.Slug(body))
+	if err != nil {
+		return []entity.Tag{}, err
 	}
 
-	return response.ID, nil
+	return tags, nil
 }
 
-func createPoint(point int, comment string, token string) error {
-	input := struct {
-		Number  int    `json:"number"`
-		Comment string `json:"comment"`
-		Token   string `json:"token"`
-	}{
-		point,
-		comment,
-		token,
+func createPostTagModel(tx repository.Store, postID uint, tagID uint) error {
+	createPostTag := entity.PostTag{
+		PostID: postID,
+		TagID:  tagID,
+	}
+	if err := tx.PostTags().Create(&createPostTag); err != nil {
+		return err
 	}
-	error := struct {
-		Error string
-	}{}
 
-	baseURL := os.Getenv("POINT_URL")
-	resp, err := napping.Post(baseURL+"/points", &input, nil, &error)
+	return nil
+}
 
+// replacePostTags 投稿情報のタグをinputTagsに置き換える。現在のタグとの差分のみ付け外しする。
+// 表記違いで同じタグが複数指定された場合も1つだけ付ける。
+// pruneの場合、外したタグがどの投稿情報にも付いていなければ削除する。
+func replacePostTags(tx repository.Store, normalizer TagNormalizer, postID uint, inputTags []entity.Tag, prune bool) error {
+	current, err := tx.Tags().FindByPostID(postID)
 	if err != nil {
 		return err
 	}
+	tagged := map[uint]bool{}
+	for _, tag := range current {
+		tagged[tag.ID] = true
+	}
 
-	if resp.Status() == http.StatusBadRequest {
-		return errors.New("token invalid")
+	wanted := map[uint]bool{}
+	for _, inputTag := range inputTags {
+		tag, err := createTagModel(tx, normalizer, inputTag)
+		if err == ErrEmptyTagBody {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if wanted[tag.ID] {
+			continue
+		}
+		wanted[tag.ID] = true
+
+		if tagged[tag.ID] {
+			continue
+		}
+		if err := createPostTagModel(tx, postID, tag.ID); err != nil {
+			return err
+		}
+	}
+
+	for tagID := range tagged {
+		if wanted[tagID] {
+			continue
+		}
+		if err := tx.PostTags().Delete(postID, tagID); err != nil {
+			return err
+		}
+		if !prune {
+			continue
+		}
+
+		count, err := tx.Tags().CountPosts(tagID)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			if err := tx.Tags().Delete(tagID); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
-func getPointByUserID(id string) (int, error) {
-	response := struct {
-		Total int `json:"total"`
-	}{}
-	error := struct {
-		Error string
-	}{}
+// savePostChange 投稿情報の更新と状態遷移履歴・ポイント精算の登録を行う。
+func savePostChange(tx repository.Store, post *entity.Post, event Event, from entity.Status, actorUserID int, settlement *entity.Settlement) error {
+	if err := tx.Posts().Save(post); err != nil {
+		return err
+	}
 
-	baseURL := os.Getenv("POINT_URL")
-	resp, err := napping.Get(baseURL+"/sum/"+id, nil, &response, &error)
+	if settlement != nil {
+		if err := tx.Settlements().Create(settlement); err != nil {
+			return err
+		}
+	}
 
-	if err != nil {
-		return 0, err
+	if err := applyEscrow(tx, *post, event); err != nil {
+		return err
 	}
 
-	if resp.Status() == http.StatusBadRequest {
-		return 0, errors.New("token invalid")
+	return createPostEvent(tx, *post, event, from, actorUserID)
+}
+
+func createPostEvent(tx repository.Store, post entity.Post, event Event, from entity.Status, actorUserID int) error {
+	postEvent := entity.PostEvent{
+		PostID:       post.ID,
+		Event:        string(event),
+		ActorUserID:  uint(actorUserID),
+		OldStatus:    from,
+		NewStatus:    post.Status,
+		HelperUserID: post.HelperUserID,
+	}
+	if err := tx.PostEvents().Create(&postEvent); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// userIDByToken JWTのローカル検証が有効な場合はユーザーサービスへ問い合わせずにトークンを検証する。
+func (b Behavior) userIDByToken(ctx context.Context, token string) (int, error) {
+	if b.Verifier != nil {
+		userID, err := b.Verifier.verify(token)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", client.ErrInvalidToken, err)
+		}
+		return userID, nil
 	}
 
-	return response.Total, nil
+	return b.Users.Authenticate(ctx, token)
 }
 
-func attachJoinDataSingle(post entity.Post) (entity.JoinPost, error) {
+func (b Behavior) attachJoinDataSingle(ctx context.Context, post entity.Post) (entity.JoinPost, error) {
 	posts := []entity.Post{post}
-	postJoinPost, err := attachJoinData(posts)
+	postJoinPost, err := b.attachJoinData(ctx, posts)
 	if err != nil {
 		return entity.JoinPost{}, err
 	}
@@ -475,8 +609,20 @@ func attachJoinDataSingle(post entity.Post) (entity.JoinPost, error) {
 	return postJoinPost[0], nil
 }
 
-func attachJoinData(posts []entity.Post) ([]entity.JoinPost, error) {
-	users := getUsersData()
+func (b Behavior) attachJoinData(ctx context.Context, posts []entity.Post) ([]entity.JoinPost, error) {
+	// ユーザーサービスの障害時も、取得できなかったユーザー情報のみ未解決として投稿情報は返却する。
+	users, usersErr := b.Users.FindByIDs(ctx, userIDsOf(posts))
+	if usersErr != nil {
+		fmt.Println(usersErr)
+	}
+	if users == nil {
+		users = map[int]entity.User{}
+	}
+
+	tags, err := getTagsByPostIDs(b.Store, posts)
+	if err != nil {
+		return []entity.JoinPost{}, err
+	}
 
 	var returnData []entity.JoinPost
 	for _, post := range posts {
@@ -485,46 +631,58 @@ func attachJoinData(posts []entity.Post) ([]entity.JoinPost, error) {
 			return []entity.JoinPost{}, errors.New("postID:" + idStr + " don't have userID")
 		}
 
-		user, ok := users[int(post.UserID)]
-		if !ok {
-			user = &entity.User{}
-		}
-
-		helperUser, ok := users[int(post.HelperUserID)]
-		if !ok {
-			helperUser = &entity.User{}
-		}
-
-		tags, err := getTagByPostID(post.ID)
-		if err != nil {
-			return []entity.JoinPost{}, err
-		}
-
-		returnData = append(returnData, entity.JoinPost{Post: post, User: *user, HelperUser: *helperUser, Tags: tags})
+		user := resolveUser(users, post.UserID, usersErr != nil)
+		helperUser := resolveUser(users, post.HelperUserID, usersErr != nil)
+		returnData = append(returnData, entity.JoinPost{Post: post, User: user, HelperUser: helperUser, Tags: tags[post.ID]})
 	}
 
 	return returnData, nil
 }
 
-func getTagByPostID(postID uint) ([]entity.Tag, error) {
-	db := db.GetDB()
-	rows, err := db.
-		Table("tags").
-		Select("tags.*").
-		Joins("inner join post_tags on tags.id = post_tags.tag_id").
-		Where("post_tags.post_id = ?", postID).
-		Rows()
+// resolveUser 存在しないユーザーは空のユーザー情報とする。
+// 問い合わせに失敗し(failed)、usersにも無いユーザーは、IDのみを設定し未解決とする。
+func resolveUser(users map[int]entity.User, id uint, failed bool) entity.User {
+	if id == 0 {
+		return entity.User{}
+	}
+	user, ok := users[int(id)]
+	if !ok && failed {
+		return entity.User{ID: int(id), Unresolved: true}
+	}
+	return user
+}
+
+// IsPartial ユーザー情報を取得できなかった投稿情報が含まれる場合にtrueを返却する。
+func IsPartial(joinPosts ...entity.JoinPost) bool {
+	for _, joinPost := range joinPosts {
+		if joinPost.User.Unresolved || joinPost.HelperUser.Unresolved {
+			return true
+		}
+	}
+	return false
+}
 
-	if err != nil {
-		return []entity.Tag{}, err
+// userIDsOf 投稿者・ヘルパーのユーザーIDを重複なく取得する。
+func userIDsOf(posts []entity.Post) []int {
+	var ids []int
+	found := map[uint]bool{0: true}
+	for _, post := range posts {
+		for _, id := range []uint{post.UserID, post.HelperUserID} {
+			if !found[id] {
+				found[id] = true
+				ids = append(ids, int(id))
+			}
+		}
 	}
+	return ids
+}
 
-	var tags []entity.Tag
-	for rows.Next() {
-		var tag entity.Tag
-		db.ScanRows(rows, &tag)
-		tags = append(tags, tag)
+// getTagsByPostIDs 投稿情報に付いたタグを投稿の件数によらず1回の問い合わせで取得する。
+func getTagsByPostIDs(store repository.Store, posts []entity.Post) (map[uint][]entity.Tag, error) {
+	postIDs := make([]uint, 0, len(posts))
+	for _, post := range posts {
+		postIDs = append(postIDs, post.ID)
 	}
 
-	return tags, nil
+	return store.Tags().FindByPostIDs(postIDs)
 }
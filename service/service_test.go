@@ -1,43 +1,45 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"strconv"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/SeijiOmi/posts-service/db"
+	"github.com/SeijiOmi/posts-service/client"
 	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/SeijiOmi/posts-service/repository"
 	"github.com/stretchr/testify/assert"
 )
 
-var client = new(http.Client)
 var postDefault = entity.Post{Body: "test", Point: 100}
 var tagDefault = entity.Tag{Body: "test"}
-var tmpBaseUserURL string
-var tmpBasePointURL string
 
-func TestMain(m *testing.M) {
-	setup()
-	ret := m.Run()
-	teardown()
-	os.Exit(ret)
-}
-
-func setup() {
-	tmpBaseUserURL = os.Getenv("USER_URL")
-	tmpBasePointURL = os.Getenv("POINT_URL")
-	os.Setenv("USER_URL", "http://post-mock-user:3000")
-	os.Setenv("POINT_URL", "http://post-mock-point:3000")
-	db.Init()
-	initPostTable()
+// テスト用トークンはモックによりユーザーID:1として認証される。
+var testUser = entity.AuthUser{ID: 1, Token: "testToken"}
+var ctx = context.Background()
+var testStore = repository.NewMemoryStore()
+var testUsers = &client.FakeUserDirectory{
+	Users: map[int]entity.User{
+		1: {ID: 1, Name: "taro"},
+		2: {ID: 2, Name: "yamada"},
+		3: {ID: 3, Name: "itoko"},
+		4: {ID: 4, Name: "domi"},
+		5: {ID: 5, Name: "dami"},
+	},
+	Tokens: map[string]int{"testToken": 1},
 }
-func teardown() {
-	initPostTable()
-	db.Close()
-	os.Setenv("USER_URL", tmpBaseUserURL)
-	os.Setenv("POINT_URL", tmpBasePointURL)
+
+// testPoints 保有ポイントは全ユーザー1000とする。
+var testPoints *client.FakePointLedger
+
+func TestMain(m *testing.M) {
+	initTable()
+	os.Exit(m.Run())
 }
 
 func TestGetAll(t *testing.T) {
@@ -45,7 +47,7 @@ func TestGetAll(t *testing.T) {
 	createDefaultPost(0, 1, 0)
 	post := createDefaultPost(0, 1, 2)
 
-	var b Behavior
+	b := testBehavior()
 	posts, err := b.GetAll(0)
 	assert.Equal(t, err, nil)
 	assert.Equal(t, len(posts), 2)
@@ -53,17 +55,56 @@ func TestGetAll(t *testing.T) {
 	assert.Equal(t, post.ID, posts[0].ID)
 }
 
-func TestFindByColumn(t *testing.T) {
+func TestFindByField(t *testing.T) {
 	initPostTable()
 	createDefaultPost(0, 1, 1)
 	post := createDefaultPost(0, 1, 2)
 
-	var b Behavior
-	posts, err := b.FindByColumn("user_id", "1", 0)
+	b := testBehavior()
+	posts, err := b.FindByField(FieldUserID, 1, 0)
 	assert.Equal(t, nil, err)
 	assert.Equal(t, 2, len(posts))
 	// 最後に作成した投稿情報が先頭であることを確認
 	assert.Equal(t, post.ID, posts[0].ID)
+
+	posts, err = b.FindByField(FieldHelperUserID, 2, 0)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(posts))
+	assert.Equal(t, post.ID, posts[0].ID)
+}
+
+func TestFindByFieldUnknown(t *testing.T) {
+	initPostTable()
+	createDefaultPost(0, 1, 1)
+
+	b := testBehavior()
+	for _, field := range []PostField{0, FieldHelperUserID + 1, -1} {
+		posts, err := b.FindByField(field, 1, 0)
+		assert.Equal(t, ErrUnknownField, err, field)
+		assert.Equal(t, 0, len(posts))
+	}
+}
+
+func TestParsePostField(t *testing.T) {
+	field, err := ParsePostField("helper_user_id")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, FieldHelperUserID, field)
+
+	// 既知の項目名以外は、SQLとして有効な文字列も含めて全て受け付けない。
+	for _, name := range []string{
+		"",
+		"id",
+		"body",
+		"USER_ID",
+		" user_id",
+		"user_id = 1 OR 1",
+		"user_id; DROP TABLE posts; --",
+		"posts.user_id",
+		"(SELECT user_id FROM posts)",
+	} {
+		_, err := ParsePostField(name)
+		assert.Equal(t, ErrUnknownField, err, name)
+	}
 }
 
 func TestAttachJoinData(t *testing.T) {
@@ -71,12 +112,13 @@ func TestAttachJoinData(t *testing.T) {
 	post := createDefaultPost(0, 1, 2)
 	tag := createDefaultTag()
 	createTestPostTag(post.ID, tag.ID)
-	tag = createDefaultTag()
+	tag = createBodyTag("test2")
 	createTestPostTag(post.ID, tag.ID)
 
 	posts := []entity.Post{post}
 
-	postsJoinData, err := attachJoinData(posts)
+	b := testBehavior()
+	postsJoinData, err := b.attachJoinData(ctx, posts)
 	assert.Equal(t, nil, err)
 	assert.NotEqual(t, "", postsJoinData[0].User.Name)
 	assert.NotEqual(t, "", postsJoinData[0].HelperUser.Name)
@@ -84,24 +126,60 @@ func TestAttachJoinData(t *testing.T) {
 	assert.NotEqual(t, "", postsJoinData[0].Tags[1].Body)
 }
 
-func TestGetTagByPostID(t *testing.T) {
+func TestAttachJoinDataUsersUnavailable(t *testing.T) {
+	initTable()
+	post := createDefaultPost(0, 1, 0)
+	testUsers.Err = errors.New("unavailable")
+	defer func() { testUsers.Err = nil }()
+
+	b := testBehavior()
+	postsJoinData, err := b.attachJoinData(ctx, []entity.Post{post})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, entity.User{ID: 1, Unresolved: true}, postsJoinData[0].User)
+	assert.Equal(t, entity.User{}, postsJoinData[0].HelperUser)
+	assert.True(t, IsPartial(postsJoinData...))
+}
+
+func TestAttachJoinDataUsersPartiallyUnavailable(t *testing.T) {
+	initTable()
+	post := createDefaultPost(0, 1, 2)
+	b := testBehavior()
+	b.Users = client.NewCachingUserDirectory(testUsers, client.CacheConfig{TTL: time.Minute})
+	b.Users.FindByIDs(ctx, []int{1})
+
+	testUsers.Err = errors.New("unavailable")
+	defer func() { testUsers.Err = nil }()
+
+	// キャッシュにあるユーザー情報は使用し、取得できなかったヘルパーのみ未解決とする。
+	postsJoinData, err := b.attachJoinData(ctx, []entity.Post{post})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, testUsers.Users[1], postsJoinData[0].User)
+	assert.Equal(t, entity.User{ID: 2, Unresolved: true}, postsJoinData[0].HelperUser)
+	assert.True(t, IsPartial(postsJoinData...))
+}
+
+func TestGetTagsByPostIDs(t *testing.T) {
 	initTable()
 	post := createDefaultPost(0, 1, 2)
 	tag := createDefaultTag()
 	createTestPostTag(post.ID, tag.ID)
-	tag = createDefaultTag()
+	tag = createBodyTag("test2")
 	createTestPostTag(post.ID, tag.ID)
 
-	tags, err := getTagByPostID(post.ID)
+	other := createDefaultPost(0, 1, 2)
+	createTestPostTag(other.ID, tag.ID)
+
+	tags, err := getTagsByPostIDs(testStore, []entity.Post{post, other})
 
 	assert.Equal(t, nil, err)
-	assert.Equal(t, 2, len(tags))
+	assert.Equal(t, 2, len(tags[post.ID]))
+	assert.Equal(t, 1, len(tags[other.ID]))
 }
 
-func TestGetTagByPostIDNoData(t *testing.T) {
+func TestGetTagsByPostIDsNoData(t *testing.T) {
 	initTable()
 
-	_, err := getTagByPostID(1)
+	_, err := getTagsByPostIDs(testStore, []entity.Post{{ID: 1}})
 
 	assert.Equal(t, nil, err)
 }
@@ -111,8 +189,9 @@ func TestGetByHelperUserIDAttachJoinData(t *testing.T) {
 	createDefaultPost(0, 1, 1)
 	createDefaultPost(0, 1, 2)
 
-	var b Behavior
-	postsWithUser, err := b.GetByHelperUserIDAttachJoinData("1", 0)
+	b := testBehavior()
+	page, err := b.GetByHelperUserIDAttachJoinData(ctx, "1", Page{})
+	postsWithUser := page.Items
 	assert.Equal(t, nil, err)
 	assert.Equal(t, 1, len(postsWithUser))
 	assert.NotEqual(t, "", postsWithUser[0].User.Name)
@@ -124,8 +203,9 @@ func TestGetUserIDAttachJoinData(t *testing.T) {
 	createDefaultPost(0, 1, 1)
 	createDefaultPost(0, 2, 1)
 
-	var b Behavior
-	postsWithUser, err := b.GetByUserIDAttachJoinData("1", 0)
+	b := testBehavior()
+	page, err := b.GetByUserIDAttachJoinData(ctx, "1", Page{})
+	postsWithUser := page.Items
 	assert.Equal(t, nil, err)
 	assert.Equal(t, 1, len(postsWithUser))
 	assert.NotEqual(t, "", postsWithUser[0].User.Name)
@@ -135,7 +215,7 @@ func TestGetUserIDAttachJoinData(t *testing.T) {
 func TestCreateModel(t *testing.T) {
 	initTable()
 
-	var b Behavior
+	b := testBehavior()
 	createPost := entity.JoinPost{
 		Post: postDefault,
 		Tags: []entity.Tag{
@@ -145,7 +225,7 @@ func TestCreateModel(t *testing.T) {
 			entity.Tag{ID: 0, Body: "TEST1"},
 		},
 	}
-	post, err := b.CreateModel(createPost, "testToken")
+	post, err := b.CreateModel(ctx, createPost, testUser)
 
 	assert.Equal(t, nil, err)
 	assert.Equal(t, postDefault.Body, post.Post.Body)
@@ -153,11 +233,81 @@ func TestCreateModel(t *testing.T) {
 	assert.NotEqual(t, uint(0), post.Post.UserID)
 }
 
+// TestTransactionIsolation MemoryStoreのロールバックがトランザクション外の書き込みを巻き戻さないことを確認する。
+// MySQLでの分離はintegrationタグのrepository.TestGormTransactionIsolationで確認する。
+func TestTransactionIsolation(t *testing.T) {
+	initPostTable()
+	inTx := make(chan struct{})
+	outsideStarted := make(chan struct{})
+	rollback := errors.New("rollback")
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		err := testStore.Transaction(func(tx repository.Store) error {
+			post := postDefault
+			post.ID = 1
+			post.UserID = 1
+			tx.Posts().Create(&post)
+			close(inTx)
+			// 別のリクエストが書き込みを始めてからロールバックする。
+			<-outsideStarted
+			return rollback
+		})
+		assert.Equal(t, rollback, err)
+	}()
+
+	<-inTx
+	go func() {
+		defer wg.Done()
+		close(outsideStarted)
+		createDefaultPost(2, 2, 0)
+	}()
+	wg.Wait()
+
+	b := testBehavior()
+	_, err := b.GetByID("1")
+	assert.NotEqual(t, nil, err)
+	post, err := b.GetByID("2")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint(2), post.UserID)
+}
+
+// TestCreateModelConcurrent MySQLのuser_locksによる直列化はintegrationタグのTestCreateModelConcurrentMySQLで確認する。
+func TestCreateModelConcurrent(t *testing.T) {
+	initTable()
+	b := testBehavior()
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := b.CreateModel(ctx, entity.JoinPost{Post: entity.Post{Body: "test", Point: 200}}, testUser)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// 保有1000ポイントに対して200ポイントの投稿は5件まで
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+		} else {
+			assert.IsType(t, &InsufficientPointsError{}, err)
+		}
+	}
+	assert.Equal(t, 5, succeeded)
+}
+
 func TestCreateTagModel(t *testing.T) {
 	initTable()
 	tag := entity.Tag{ID: 0, Body: "TEST1"}
-	tagFirst, errFirst := createTagModel(tag)
-	tagSecond, errSecond := createTagModel(tag)
+	tagFirst, errFirst := createTagModel(testStore, TagNormalizer{}, tag)
+	tagSecond, errSecond := createTagModel(testStore, TagNormalizer{}, tag)
 	assert.Equal(t, nil, errFirst)
 	assert.Equal(t, nil, errSecond)
 	assert.Equal(t, tagFirst, tagSecond)
@@ -165,81 +315,202 @@ func TestCreateTagModel(t *testing.T) {
 
 func TestDone(t *testing.T) {
 	initPostTable()
-	createDefaultPost(1, 2, 1)
-	var b Behavior
-	post, err := b.DonePayment("1", "testToken")
+	createDefaultPost(1, 1, 2)
+	b := testBehavior()
+	post, err := b.DonePayment(ctx, "1", testUser)
 
 	assert.Equal(t, nil, err)
 	assert.Equal(t, entity.Payment, post.Post.Status)
 
-	post, err = b.DoneAcceptance("1", "testToken")
+	createStatusPost(2, 2, 1, entity.Payment)
+	post, err = b.DoneAcceptance(ctx, "2", testUser)
 	assert.Equal(t, nil, err)
 	assert.Equal(t, entity.Acceptance, post.Post.Status)
 }
 
+func TestGetHistoryByPostID(t *testing.T) {
+	initPostTable()
+	createDefaultPost(1, 1, 2)
+	b := testBehavior()
+	b.TakeHelpUserID(ctx, "1", testUser)
+
+	events, err := b.GetHistoryByPostID("1")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, string(EventUnmatch), events[0].Event)
+	assert.Equal(t, entity.Matched, events[0].OldStatus)
+	assert.Equal(t, entity.Open, events[0].NewStatus)
+	assert.Equal(t, uint(1), events[0].ActorUserID)
+}
+
+func TestGetHistoryByPostIDCancelled(t *testing.T) {
+	initPostTable()
+	b := testBehavior()
+	post, _ := b.CreateModel(ctx, entity.JoinPost{Post: postDefault}, testUser)
+	id := strconv.Itoa(int(post.Post.ID))
+	assert.Equal(t, nil, b.DeleteByID(id, testUser))
+
+	events, err := b.GetHistoryByPostID(id)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, string(EventCancel), events[1].Event)
+	assert.Equal(t, entity.Cancelled, events[1].NewStatus)
+
+	_, err = b.GetHistoryByPostID("100")
+	assert.Equal(t, repository.ErrNotFound, err)
+}
+
 func TestDoneAcceptanceErr(t *testing.T) {
 	initPostTable()
 	createDefaultPost(1, 2, 1)
-	var b Behavior
-	post, err := b.DoneAcceptance("1", "testToken")
+	b := testBehavior()
+	post, err := b.DoneAcceptance(ctx, "1", testUser)
 
 	assert.NotEqual(t, nil, err)
 	assert.NotEqual(t, entity.Payment, post.Post.Status)
 }
 
-func TestGetAmountPaymentByUserID(t *testing.T) {
+func TestTakeHelpUserIDAfterPaymentErr(t *testing.T) {
 	initPostTable()
-	createDefaultPost(0, 1, 2)
-	var b Behavior
-	amountPayment, err := b.GetAmountPaymentByUserID("1")
+	createDefaultPost(1, 1, 2)
+	b := testBehavior()
+	_, err := b.DonePayment(ctx, "1", testUser)
+	assert.Equal(t, nil, err)
+
+	_, err = b.TakeHelpUserID(ctx, "1", testUser)
+	assert.IsType(t, &TransitionError{}, err)
+}
+
+func TestDonePaymentForbidden(t *testing.T) {
+	initPostTable()
+	createDefaultPost(1, 2, 1)
+	b := testBehavior()
+	_, err := b.DonePayment(ctx, "1", testUser)
+
+	forbidden, ok := err.(*ForbiddenError)
+	assert.True(t, ok)
+	assert.Equal(t, ReasonNotOwner, forbidden.Reason)
+}
+
+func TestDoneAcceptanceForbidden(t *testing.T) {
+	initPostTable()
+	createStatusPost(1, 1, 2, entity.Payment)
+	b := testBehavior()
+	_, err := b.DoneAcceptance(ctx, "1", testUser)
+
+	forbidden, ok := err.(*ForbiddenError)
+	assert.True(t, ok)
+	assert.Equal(t, ReasonNotHelper, forbidden.Reason)
+}
+
+func TestTakeHelpUserIDForbidden(t *testing.T) {
+	initPostTable()
+	createDefaultPost(1, 2, 3)
+	b := testBehavior()
+	_, err := b.TakeHelpUserID(ctx, "1", testUser)
+
+	forbidden, ok := err.(*ForbiddenError)
+	assert.True(t, ok)
+	assert.Equal(t, ReasonNotParticipant, forbidden.Reason)
+}
+
+func TestUpdateByID(t *testing.T) {
+	initPostTable()
+	createDefaultPost(1, 1, 0)
+	body := "updated"
+	b := testBehavior()
+	post, err := b.UpdateByID(ctx, "1", entity.PostUpdate{Body: &body}, testUser)
 
 	assert.Equal(t, nil, err)
-	assert.NotEqual(t, 0, amountPayment)
+	assert.Equal(t, body, post.Body)
+	assert.Equal(t, postDefault.Point, post.Point)
+	assert.Equal(t, uint(1), post.UserID)
 }
 
-func TestGetScheduledPaymentPointByUserID(t *testing.T) {
+func TestUpdateByIDMatchedErr(t *testing.T) {
+	initPostTable()
+	createDefaultPost(1, 1, 2)
+	body := "updated"
+	b := testBehavior()
+	_, err := b.UpdateByID(ctx, "1", entity.PostUpdate{Body: &body}, testUser)
+
+	assert.IsType(t, &TransitionError{}, err)
+}
+
+func TestUpdateByIDForbidden(t *testing.T) {
+	initPostTable()
+	createDefaultPost(1, 2, 0)
+	body := "updated"
+	b := testBehavior()
+	_, err := b.UpdateByID(ctx, "1", entity.PostUpdate{Body: &body}, testUser)
+
+	assert.IsType(t, &ForbiddenError{}, err)
+}
+
+func TestDeleteByID(t *testing.T) {
+	initPostTable()
+	createDefaultPost(1, 1, 0)
+	createDefaultPost(2, 2, 0)
+	b := testBehavior()
+
+	assert.Equal(t, nil, b.DeleteByID("1", testUser))
+	assert.IsType(t, &ForbiddenError{}, b.DeleteByID("2", testUser))
+}
+
+func TestAuthenticate(t *testing.T) {
+	b := testBehavior()
+	user, err := b.Authenticate(ctx, "testToken")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, testUser, user)
+
+	_, err = b.Authenticate(ctx, "")
+	assert.True(t, errors.Is(err, client.ErrInvalidToken))
+}
+
+func TestGetAmountPaymentByUserID(t *testing.T) {
 	initPostTable()
 	createDefaultPost(0, 1, 2)
-	payment, err := getScheduledPaymentPointByUserID("1")
+	b := testBehavior()
+	amountPayment, err := b.GetAmountPaymentByUserID(ctx, "1")
 
 	assert.Equal(t, nil, err)
-	assert.Equal(t, int(postDefault.Point), payment)
+	assert.NotEqual(t, 0, amountPayment)
 }
 
-func TestGetPointByUserID(t *testing.T) {
-	total, err := getPointByUserID("1")
+func TestGetBalanceByUserID(t *testing.T) {
+	initTable()
+	b := testBehavior()
+	b.CreateModel(ctx, entity.JoinPost{Post: postDefault}, testUser)
 
+	balance, err := b.GetBalanceByUserID(ctx, "1")
 	assert.Equal(t, nil, err)
-	assert.NotEqual(t, 0, total)
+	assert.Equal(t, 1000, balance.Total)
+	assert.Equal(t, int(postDefault.Point), balance.Held)
+	assert.Equal(t, 1000-int(postDefault.Point), balance.Available)
 }
 
 func TestGetByTagIDAttachJoinData(t *testing.T) {
 	initTable()
 	tag := createDefaultTag()
 	post := createDefaultPost(0, 1, 2)
-	createPostTagModel(post.ID, tag.ID)
+	createPostTagModel(testStore, post.ID, tag.ID)
 	post = createDefaultPost(0, 1, 2)
-	createPostTagModel(post.ID, tag.ID)
+	createPostTagModel(testStore, post.ID, tag.ID)
 
-	var b Behavior
-	posts, err := b.GetByTagIDAttachJoinData(strconv.Itoa(int(tag.ID)), 0)
+	b := testBehavior()
+	page, err := b.GetByTagIDAttachJoinData(ctx, strconv.Itoa(int(tag.ID)), Page{})
 	assert.Equal(t, nil, err)
-	assert.Equal(t, 2, len(posts))
+	assert.Equal(t, 2, len(page.Items))
 }
 
 func TestFindTagLikeBody(t *testing.T) {
 	initTable()
-	db := db.GetDB()
-	tag := entity.Tag{Body: "test1"}
-	db.Create(&tag)
-	tag = entity.Tag{Body: "1test"}
-	db.Create(&tag)
-	tag = entity.Tag{Body: "1test1"}
-	db.Create(&tag)
-	tag = entity.Tag{Body: "foo"}
-	db.Create(&tag)
-
-	var b Behavior
+	createBodyTag("test1")
+	createBodyTag("1test")
+	createBodyTag("1test1")
+	createBodyTag("foo")
+
+	b := testBehavior()
 	tags, err := b.FindTagLikeBody("test")
 	assert.Equal(t, nil, err)
 	fmt.Println(tags)
@@ -247,50 +518,53 @@ func TestFindTagLikeBody(t *testing.T) {
 }
 
 func createDefaultPost(id uint, userID uint, helpserUserID uint) entity.Post {
-	db := db.GetDB()
 	post := postDefault
 	post.ID = id
 	post.UserID = userID
 	post.HelperUserID = helpserUserID
-	db.Create(&post)
+	testStore.Posts().Create(&post)
+	return post
+}
+
+func createStatusPost(id uint, userID uint, helpserUserID uint, status entity.Status) entity.Post {
+	post := postDefault
+	post.ID = id
+	post.UserID = userID
+	post.HelperUserID = helpserUserID
+	post.Status = status
+	testStore.Posts().Create(&post)
 	return post
 }
 
 func createDefaultTag() entity.Tag {
-	db := db.GetDB()
-	tag := tagDefault
-	db.Create(&tag)
+	return createBodyTag(tagDefault.Body)
+}
+
+func createBodyTag(body string) entity.Tag {
+	tag := entity.Tag{Body: body, Slug: TagNormalizer{}.Slug(body)}
+	testStore.Tags().Create(&tag)
 	return tag
 }
 
 func createTestPostTag(postID uint, tagID uint) entity.PostTag {
-	db := db.GetDB()
 	createPostTag := entity.PostTag{
 		PostID: postID,
 		TagID:  tagID,
 	}
-	db.Create(&createPostTag)
+	testStore.PostTags().Create(&createPostTag)
 	return createPostTag
 }
 
+func testBehavior() Behavior {
+	return NewBehavior(testStore, testUsers, testPoints)
+}
+
+// initTable メモリ上のテーブルとポイントの登録を全て空にする。
 func initTable() {
-	initPostTable()
-	initTagTable()
-	initPostTagsTable()
+	testStore.Reset()
+	testPoints = &client.FakePointLedger{DefaultTotal: 1000}
 }
 
 func initPostTable() {
-	db := db.GetDB()
-	var u entity.Post
-	db.Delete(&u)
-}
-func initTagTable() {
-	db := db.GetDB()
-	var t entity.Tag
-	db.Delete(&t)
-}
-func initPostTagsTable() {
-	db := db.GetDB()
-	var pt entity.PostTag
-	db.Delete(&pt)
+	initTable()
 }
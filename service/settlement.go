@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/SeijiOmi/posts-service/client"
+	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/SeijiOmi/posts-service/repository"
+)
+
+const (
+	// settlementMaxAttempts この回数配信に失敗した精算は再送を諦める。
+	settlementMaxAttempts = 10
+	// settlementLease 配信中の精算を他のワーカーが再送しないための猶予
+	settlementLease = time.Minute
+	// settlementMaxBackoff 再送間隔の上限
+	settlementMaxBackoff = 10 * time.Minute
+)
+
+// ErrSettlementUserUnresolved 精算のコメントに使うユーザー情報をユーザーサービスから取得できなかった。
+var ErrSettlementUserUnresolved = errors.New("user for settlement comment could not be resolved")
+
+// settlementKey 投稿IDと遷移から冪等キーを生成する。
+// 状態遷移は投稿ごとに一度しか起きないため、同じ精算が二重に登録・計上されることはない。
+func settlementKey(postID uint, event Event) string {
+	return "post-" + strconv.Itoa(int(postID)) + "-" + string(event)
+}
+
+func newSettlement(post entity.Post, event Event, user entity.AuthUser, point int, comment string) entity.Settlement {
+	return entity.Settlement{
+		PostID:         post.ID,
+		Transition:     string(event),
+		IdempotencyKey: settlementKey(post.ID, event),
+		UserID:         uint(user.ID),
+		Point:          point,
+		Comment:        comment,
+		Status:         entity.SettlementPending,
+		NextAttemptAt:  time.Now(),
+	}
+}
+
+// GetSettlementsByPostID 投稿情報に紐づくポイント精算と配信状態を取得する。
+// 削除された投稿情報も精算は取得できる。
+func (b Behavior) GetSettlementsByPostID(id string) ([]entity.Settlement, error) {
+	postID, err := parsePostID(id)
+	if err != nil {
+		return []entity.Settlement{}, err
+	}
+
+	settlements, err := b.Store.Settlements().FindByPostID(postID)
+	if err != nil {
+		return []entity.Settlement{}, err
+	}
+
+	// 精算が無い場合のみ、投稿情報が存在するか確認する。
+	if len(settlements) == 0 {
+		if _, err := b.Store.Posts().FindByID(postID); err != nil {
+			return []entity.Settlement{}, err
+		}
+	}
+
+	return settlements, nil
+}
+
+// DeliverPendingSettlements 配信時刻を過ぎた未配信の精算をポイントサービスへ配信する。
+func (b Behavior) DeliverPendingSettlements(ctx context.Context) error {
+	settlements, err := b.Store.Settlements().FindDue(time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, settlement := range settlements {
+		b.deliverSettlement(ctx, settlement)
+	}
+
+	return nil
+}
+
+// StartSettlementWorker 未配信の精算を定期的に再送するワーカーを起動する。
+func (b Behavior) StartSettlementWorker(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := b.DeliverPendingSettlements(context.Background()); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}()
+}
+
+// deliverSettlement 精算を1件配信し、結果を記録する。
+// 失敗した場合はpendingのまま再送時刻を先送りし、ワーカーに任せる。
+func (b Behavior) deliverSettlement(ctx context.Context, settlement entity.Settlement) {
+	if !claimSettlement(b.Store, &settlement) {
+		return
+	}
+
+	now := time.Now()
+	settlement.Attempts++
+
+	sendErr := b.Points.Create(ctx, client.PointEntry{
+		UserID:         int(settlement.UserID),
+		Number:         settlement.Point,
+		Comment:        settlement.Comment,
+		IdempotencyKey: settlement.IdempotencyKey,
+	})
+	switch {
+	case sendErr == nil:
+		settlement.Status = entity.SettlementDelivered
+		settlement.DeliveredAt = &now
+		settlement.LastError = ""
+	case client.IsRejected(sendErr) || settlement.Attempts >= settlementMaxAttempts:
+		settlement.Status = entity.SettlementFailed
+		settlement.LastError = sendErr.Error()
+	default:
+		settlement.NextAttemptAt = now.Add(settlementBackoff(settlement.Attempts))
+		settlement.LastError = sendErr.Error()
+	}
+
+	if err := b.Store.Settlements().Save(&settlement); err != nil {
+		fmt.Println(err)
+	}
+
+	// 投稿者の支払が計上されたため、エスクローの確保分を計上済みとする。
+	if sendErr == nil && settlement.Transition == string(EventPay) {
+		if err := fundHold(b.Store, settlement.PostID); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// claimSettlement 配信権を取得する。他のワーカーが配信中の場合はfalseを返却する。
+// 取得できた場合はsettlementの再送時刻を猶予の終わりに更新する。
+func claimSettlement(store repository.Store, settlement *entity.Settlement) bool {
+	now := time.Now()
+	until := now.Add(settlementLease)
+	claimed, err := store.Settlements().Claim(settlement.ID, now, until)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+
+	if claimed {
+		settlement.NextAttemptAt = until
+	}
+	return claimed
+}
+
+func settlementBackoff(attempts int) time.Duration {
+	backoff := time.Second << uint(attempts)
+	if backoff > settlementMaxBackoff || backoff <= 0 {
+		return settlementMaxBackoff
+	}
+	return backoff
+}
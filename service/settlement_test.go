@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SeijiOmi/posts-service/client"
+	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/SeijiOmi/posts-service/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDonePaymentSettlement(t *testing.T) {
+	initPostTable()
+	createDefaultPost(1, 1, 2)
+	b := testBehavior()
+	_, err := b.DonePayment(ctx, "1", testUser)
+	assert.Equal(t, nil, err)
+
+	settlements, err := b.GetSettlementsByPostID("1")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(settlements))
+	assert.Equal(t, "post-1-pay", settlements[0].IdempotencyKey)
+	assert.Equal(t, -int(postDefault.Point), settlements[0].Point)
+	assert.Equal(t, entity.SettlementDelivered, settlements[0].Status)
+	assert.Equal(t, 1, settlements[0].Attempts)
+
+	entries := testPoints.Entries()
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "post-1-pay", entries[0].IdempotencyKey)
+	// 配信先はユーザーのトークンではなくユーザーIDで指定する。
+	assert.Equal(t, testUser.ID, entries[0].UserID)
+	assert.Equal(t, -int(postDefault.Point), entries[0].Number)
+}
+
+func TestDonePaymentUserUnresolved(t *testing.T) {
+	initPostTable()
+	createDefaultPost(1, 1, 2)
+	b := testBehavior()
+	testUsers.Err = errors.New("unavailable")
+	defer func() { testUsers.Err = nil }()
+
+	// ヘルパーの名前が取得できない場合は、名前の無いコメントで精算しない。
+	_, err := b.DonePayment(ctx, "1", testUser)
+	assert.Equal(t, ErrSettlementUserUnresolved, err)
+	settlements, _ := b.GetSettlementsByPostID("1")
+	assert.Equal(t, 0, len(settlements))
+	post, _ := b.GetByID("1")
+	assert.Equal(t, entity.Matched, currentStatus(post))
+	assert.Equal(t, 0, len(testPoints.Entries()))
+
+	testUsers.Err = nil
+	_, err = b.DonePayment(ctx, "1", testUser)
+	assert.Equal(t, nil, err)
+	settlements, _ = b.GetSettlementsByPostID("1")
+	assert.Equal(t, "yamadaさんが助けてくれました！", settlements[0].Comment)
+}
+
+func TestDeliverPendingSettlementsRetry(t *testing.T) {
+	initPostTable()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	post := createDefaultPost(1, 1, 2)
+	settlement := newSettlement(post, EventPay, testUser, -100, "test")
+	testStore.Settlements().Create(&settlement)
+
+	b := testBehavior()
+	b.Points = client.NewHTTPPointLedger(failing.URL, "", 0)
+	assert.Equal(t, nil, b.DeliverPendingSettlements(ctx))
+	b = testBehavior()
+
+	settlements, _ := b.GetSettlementsByPostID("1")
+	assert.Equal(t, entity.SettlementPending, settlements[0].Status)
+	assert.Equal(t, 1, settlements[0].Attempts)
+	assert.True(t, settlements[0].NextAttemptAt.After(time.Now()))
+
+	// 再送時刻になるまでは配信しない。
+	assert.Equal(t, nil, b.DeliverPendingSettlements(ctx))
+	settlements, _ = b.GetSettlementsByPostID("1")
+	assert.Equal(t, entity.SettlementPending, settlements[0].Status)
+
+	settlements[0].NextAttemptAt = time.Now().Add(-time.Minute)
+	testStore.Settlements().Save(&settlements[0])
+	assert.Equal(t, nil, b.DeliverPendingSettlements(ctx))
+	settlements, _ = b.GetSettlementsByPostID("1")
+	assert.Equal(t, entity.SettlementDelivered, settlements[0].Status)
+	assert.Equal(t, 2, settlements[0].Attempts)
+}
+
+func TestSettlementIdempotencyKeyUnique(t *testing.T) {
+	initPostTable()
+	post := createDefaultPost(1, 1, 2)
+	first := newSettlement(post, EventPay, testUser, -100, "test")
+	second := newSettlement(post, EventPay, testUser, -100, "test")
+
+	assert.Equal(t, nil, testStore.Settlements().Create(&first))
+	assert.Equal(t, repository.ErrDuplicate, testStore.Settlements().Create(&second))
+}
+
+func TestSettlementBackoff(t *testing.T) {
+	assert.Equal(t, 2*time.Second, settlementBackoff(1))
+	assert.Equal(t, 8*time.Second, settlementBackoff(3))
+	assert.Equal(t, settlementMaxBackoff, settlementBackoff(30))
+	assert.Equal(t, settlementMaxBackoff, settlementBackoff(100))
+}
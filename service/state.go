@@ -0,0 +1,91 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+// Event 投稿情報の状態を変化させる操作
+type Event string
+
+const (
+	// EventCreate 投稿（履歴記録用。遷移表には含めない）
+	EventCreate Event = "create"
+	// EventMatch ヘルパー決定
+	EventMatch Event = "match"
+	// EventUnmatch ヘルパー取り消し
+	EventUnmatch Event = "unmatch"
+	// EventPay 投稿者支払
+	EventPay Event = "pay"
+	// EventAccept ヘルパー受け取り
+	EventAccept Event = "accept"
+	// EventEdit 投稿内容の編集（状態は変化しない。ヘルパー決定後は不可）
+	EventEdit Event = "edit"
+	// EventCancel 投稿の取り消し
+	EventCancel Event = "cancel"
+)
+
+// transitions 状態ごとに許可された操作と遷移先の一覧。
+// ここに存在しない組み合わせは全て拒否する。
+var transitions = map[entity.Status]map[Event]entity.Status{
+	entity.Open: {
+		EventMatch:  entity.Matched,
+		EventEdit:   entity.Open,
+		EventCancel: entity.Cancelled,
+	},
+	entity.Matched: {
+		EventUnmatch: entity.Open,
+		EventPay:     entity.Paid,
+		EventCancel:  entity.Cancelled,
+	},
+	entity.Paid: {
+		EventAccept: entity.Accepted,
+	},
+}
+
+// TransitionError 許可されていない状態遷移を要求された場合のエラー
+type TransitionError struct {
+	PostID uint
+	From   entity.Status
+	Event  Event
+}
+
+func (e *TransitionError) Error() string {
+	return "PostID:" + strconv.Itoa(int(e.PostID)) + " can't " + string(e.Event) + " in status " + e.From.String()
+}
+
+// ErrPostChanged 操作の準備中に他の操作で投稿情報が変更された。
+var ErrPostChanged = errors.New("post was changed by another request")
+
+// currentStatus 投稿情報の現在の状態を取得する。
+// 旧データはヘルパーが決まっていてもNone(Open)のままのため、Matchedとして扱う。
+// 保存済みの旧データは起動時の移行(db.migrateLegacyMatched)でMatchedに更新している。
+func currentStatus(post entity.Post) entity.Status {
+	if post.Status == entity.Open && post.HelperUserID != 0 {
+		return entity.Matched
+	}
+	return post.Status
+}
+
+// canTransition 指定された操作が現在の状態で許可されているか確認する。
+func canTransition(post entity.Post, event Event) (entity.Status, error) {
+	from := currentStatus(post)
+	to, ok := transitions[from][event]
+	if !ok {
+		return from, &TransitionError{PostID: post.ID, From: from, Event: event}
+	}
+	return to, nil
+}
+
+// transition 投稿情報の状態をeventに従って遷移させ、遷移前の状態を返却する。
+func transition(post *entity.Post, event Event) (entity.Status, error) {
+	from := currentStatus(*post)
+	to, err := canTransition(*post, event)
+	if err != nil {
+		return from, err
+	}
+	post.Status = to
+	return from, nil
+}
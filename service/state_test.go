@@ -0,0 +1,131 @@
+package service
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/SeijiOmi/posts-service/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransition(t *testing.T) {
+	cases := []struct {
+		from  entity.Status
+		event Event
+		to    entity.Status
+		ok    bool
+	}{
+		{entity.Open, EventMatch, entity.Matched, true},
+		{entity.Open, EventPay, entity.Open, false},
+		{entity.Matched, EventUnmatch, entity.Open, true},
+		{entity.Matched, EventPay, entity.Paid, true},
+		{entity.Paid, EventUnmatch, entity.Paid, false},
+		{entity.Paid, EventAccept, entity.Accepted, true},
+		{entity.Accepted, EventAccept, entity.Accepted, false},
+		{entity.Cancelled, EventMatch, entity.Cancelled, false},
+	}
+
+	for _, c := range cases {
+		post := entity.Post{ID: 1, Status: c.from}
+		if c.from != entity.Open {
+			post.HelperUserID = 2
+		}
+		_, err := transition(&post, c.event)
+		if c.ok {
+			assert.Equal(t, nil, err)
+		} else {
+			assert.IsType(t, &TransitionError{}, err)
+		}
+		assert.Equal(t, c.to, post.Status)
+	}
+}
+
+func TestCurrentStatusLegacyMatched(t *testing.T) {
+	post := entity.Post{Status: entity.None, HelperUserID: 1}
+	assert.Equal(t, entity.Matched, currentStatus(post))
+}
+
+// interleavedStore トランザクション外で投稿情報を読み込んだ直後に、1回だけbetweenを実行する。
+type interleavedStore struct {
+	repository.Store
+	between *func()
+}
+
+func (s interleavedStore) Posts() repository.PostRepository {
+	return interleavedPosts{s.Store.Posts(), s.between}
+}
+
+type interleavedPosts struct {
+	repository.PostRepository
+	between *func()
+}
+
+func (r interleavedPosts) FindByID(id uint) (entity.Post, error) {
+	post, err := r.PostRepository.FindByID(id)
+	if between := *r.between; between != nil {
+		*r.between = nil
+		between()
+	}
+	return post, err
+}
+
+func TestDonePaymentHelperChanged(t *testing.T) {
+	initPostTable()
+	createDefaultPost(1, 1, 2)
+
+	// 支払の準備中にヘルパーが入れ替わる。
+	between := func() {
+		other := testBehavior()
+		other.TakeHelpUserID(ctx, "1", entity.AuthUser{ID: 2})
+		other.SetHelpUserID(ctx, "1", entity.AuthUser{ID: 3})
+	}
+	b := testBehavior()
+	b.Store = interleavedStore{testStore, &between}
+
+	_, err := b.DonePayment(ctx, "1", testUser)
+	assert.Equal(t, ErrPostChanged, err)
+
+	post, _ := testStore.Posts().FindByID(1)
+	assert.Equal(t, entity.Matched, post.Status)
+	assert.Equal(t, uint(3), post.HelperUserID)
+	settlements, _ := testStore.Settlements().FindByPostID(1)
+	assert.Equal(t, 0, len(settlements))
+}
+
+func TestSetHelpUserIDConcurrentEdit(t *testing.T) {
+	initPostTable()
+	createDefaultPost(1, 1, 0)
+	b := testBehavior()
+	body := "updated"
+
+	var wg sync.WaitGroup
+	var editErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, err := b.SetHelpUserID(ctx, "1", entity.AuthUser{ID: 2})
+		assert.Equal(t, nil, err)
+	}()
+	go func() {
+		defer wg.Done()
+		_, editErr = b.UpdateByID(ctx, "1", entity.PostUpdate{Body: &body}, testUser)
+	}()
+	wg.Wait()
+
+	// ヘルパーは消えず、ヘルパー決定後の編集は拒否される。
+	post, _ := testStore.Posts().FindByID(1)
+	assert.Equal(t, entity.Matched, post.Status)
+	assert.Equal(t, uint(2), post.HelperUserID)
+
+	events, _ := b.GetHistoryByPostID("1")
+	last := events[len(events)-1]
+	assert.Equal(t, string(EventMatch), last.Event)
+	if editErr != nil {
+		assert.IsType(t, &TransitionError{}, editErr)
+		assert.Equal(t, 1, len(events))
+	} else {
+		assert.Equal(t, body, post.Body)
+		assert.Equal(t, 2, len(events))
+	}
+}
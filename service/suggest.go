@@ -0,0 +1,217 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+const (
+	// defaultSuggestLimit 候補の件数の既定値
+	defaultSuggestLimit = 10
+	// maxSuggestLimit 候補の件数の上限
+	maxSuggestLimit = 20
+)
+
+// tagSuggestIndex タグ名の入力補完用の索引。
+// ひらがな・カタカナを区別せずに照合するため、slugのカタカナをひらがなに揃えた値をキーとする。
+type tagSuggestIndex struct {
+	root *suggestNode
+	tags []suggestEntry
+}
+
+type suggestNode struct {
+	children map[rune]*suggestNode
+	// tags このノードで終わるキーを持つタグ(tagSuggestIndex.tagsの添字)
+	tags []int
+}
+
+type suggestEntry struct {
+	key string
+	tag entity.TagCount
+}
+
+func newTagSuggestIndex(tags []entity.TagCount) *tagSuggestIndex {
+	index := &tagSuggestIndex{root: &suggestNode{}}
+	for _, tag := range tags {
+		key := foldKana(tag.Slug)
+		if key == "" {
+			continue
+		}
+		index.tags = append(index.tags, suggestEntry{key: key, tag: tag})
+
+		node := index.root
+		for _, r := range key {
+			if node.children == nil {
+				node.children = map[rune]*suggestNode{}
+			}
+			child, ok := node.children[r]
+			if !ok {
+				child = &suggestNode{}
+				node.children[r] = child
+			}
+			node = child
+		}
+		node.tags = append(node.tags, len(index.tags)-1)
+	}
+	return index
+}
+
+// prefixed keyで始まるタグの添字を、keyのノード以下の部分木のみを辿って取得する。
+func (index *tagSuggestIndex) prefixed(key string) []int {
+	node := index.root
+	for _, r := range key {
+		node = node.children[r]
+		if node == nil {
+			return nil
+		}
+	}
+
+	var found []int
+	stack := []*suggestNode{node}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		found = append(found, node.tags...)
+		for _, child := range node.children {
+			stack = append(stack, child)
+		}
+	}
+	return found
+}
+
+// contained keyを途中に含むタグの添字を取得する。excludeのタグは除く。
+// 全てのタグを走査するため、前方一致の件数が足りない場合のみ使用する。
+func (index *tagSuggestIndex) contained(key string, exclude []int) []int {
+	excluded := map[int]bool{}
+	for _, i := range exclude {
+		excluded[i] = true
+	}
+
+	var found []int
+	for i, entry := range index.tags {
+		if !excluded[i] && strings.Contains(entry.key, key) {
+			found = append(found, i)
+		}
+	}
+	return found
+}
+
+// rank 投稿数の多い順、タグ名の短い順、IDの昇順に並べる。
+func (index *tagSuggestIndex) rank(matched []int) {
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := index.tags[matched[i]], index.tags[matched[j]]
+		if a.tag.PostCount != b.tag.PostCount {
+			return a.tag.PostCount > b.tag.PostCount
+		}
+		if len(a.key) != len(b.key) {
+			return len(a.key) < len(b.key)
+		}
+		return a.tag.ID < b.tag.ID
+	})
+}
+
+// suggest keyを含むタグを最大limit件返却する。
+// 前方一致するタグをトライから取得し、部分一致のみのタグはその後に並べる。
+// 前方一致でlimit件に達した場合は部分一致を探さない。
+func (index *tagSuggestIndex) suggest(key string, limit int) []entity.TagCount {
+	matched := index.prefixed(key)
+	index.rank(matched)
+
+	if len(matched) < limit {
+		contained := index.contained(key, matched)
+		index.rank(contained)
+		matched = append(matched, contained...)
+	}
+
+	if len(matched) > limit {
+		matched = matched[:limit]
+	}
+	tags := make([]entity.TagCount, 0, len(matched))
+	for _, i := range matched {
+		tags = append(tags, index.tags[i].tag)
+	}
+	return tags
+}
+
+// tagSuggester 入力補完用の索引を保持する。索引はRefreshTagSuggestionsで作り直す。
+// nilの場合(NewBehaviorを使わずに生成したBehavior)は索引を保持せず、呼び出しごとに作成する。
+type tagSuggester struct {
+	mu    sync.RWMutex
+	index *tagSuggestIndex
+}
+
+func newTagSuggester() *tagSuggester {
+	return &tagSuggester{}
+}
+
+func (s *tagSuggester) get() *tagSuggestIndex {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.index
+}
+
+func (s *tagSuggester) set(index *tagSuggestIndex) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index = index
+}
+
+// RefreshTagSuggestions タグと投稿数を読み込み、入力補完用の索引を作り直す。
+func (b Behavior) RefreshTagSuggestions() error {
+	tags, err := b.Store.Tags().FindAllWithCount()
+	if err != nil {
+		return err
+	}
+	b.suggest.set(newTagSuggestIndex(tags))
+	return nil
+}
+
+// StartTagSuggestRefresher 入力補完用の索引を定期的に作り直すワーカーを起動する。
+// タグの追加・変更は次に索引を作り直すまで候補に反映されない。
+func (b Behavior) StartTagSuggestRefresher(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := b.RefreshTagSuggestions(); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}()
+}
+
+// GetTagSuggestions 入力途中のタグ名から候補のタグを取得する。
+// ひらがな・カタカナを区別せずに照合する。limitが0の場合は既定の件数、maxSuggestLimitを超える場合はmaxSuggestLimitとする。
+// 索引が未作成の場合はその場で作成する。
+func (b Behavior) GetTagSuggestions(q string, limit int) ([]entity.TagCount, error) {
+	key := foldKana(b.TagNormalizer.Slug(q))
+	if key == "" {
+		return nil, &InvalidFilterError{Param: "q", Value: q}
+	}
+	switch {
+	case limit <= 0:
+		limit = defaultSuggestLimit
+	case limit > maxSuggestLimit:
+		limit = maxSuggestLimit
+	}
+
+	index := b.suggest.get()
+	if index == nil {
+		tags, err := b.Store.Tags().FindAllWithCount()
+		if err != nil {
+			return nil, err
+		}
+		index = newTagSuggestIndex(tags)
+		b.suggest.set(index)
+	}
+	return index.suggest(key, limit), nil
+}
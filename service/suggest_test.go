@@ -0,0 +1,90 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+func tagIDsOf(tags []entity.TagCount) []uint {
+	ids := []uint{}
+	for _, tag := range tags {
+		ids = append(ids, tag.ID)
+	}
+	return ids
+}
+
+func TestGetTagSuggestions(t *testing.T) {
+	initTable()
+	cafe := createBodyTag("カフェ")
+	tour := createBodyTag("かふぇ巡り")
+	stylish := createBodyTag("おしゃれカフェ")
+	latin := createBodyTag("Cafe")
+	createBodyTag("散歩")
+
+	for tag, count := range map[entity.Tag]int{cafe: 2, tour: 3, stylish: 5} {
+		for i := 0; i < count; i++ {
+			createAgedPost(0, entity.Open, tag)
+		}
+	}
+
+	cases := []struct {
+		q     string
+		limit int
+		ids   []uint
+	}{
+		// 前方一致を投稿数の多い順に並べ、部分一致はその後とする。
+		{"かふぇ", 0, []uint{tour.ID, cafe.ID, stylish.ID}},
+		{"カフェ", 0, []uint{tour.ID, cafe.ID, stylish.ID}},
+		// 前方一致でlimit件に達した場合は、投稿数が多くても部分一致のみのタグは含めない。
+		{"ｶﾌｪ", 2, []uint{tour.ID, cafe.ID}},
+		{"巡り", 0, []uint{tour.ID}},
+		{"ＣＡＦ", 0, []uint{latin.ID}},
+		{"ピザ", 0, []uint{}},
+	}
+
+	b := testBehavior()
+	for _, c := range cases {
+		tags, err := b.GetTagSuggestions(c.q, c.limit)
+		assert.Equal(t, nil, err, c.q)
+		assert.Equal(t, c.ids, tagIDsOf(tags), c.q)
+	}
+
+	_, err := b.GetTagSuggestions(" ", 0)
+	_, ok := err.(*InvalidFilterError)
+	assert.True(t, ok)
+}
+
+func TestRefreshTagSuggestions(t *testing.T) {
+	initTable()
+	b := testBehavior()
+	first := createBodyTag("掃除")
+	tags, _ := b.GetTagSuggestions("掃除", 0)
+	assert.Equal(t, []uint{first.ID}, tagIDsOf(tags))
+
+	// 索引を作り直すまで追加したタグは候補に含まれない。
+	second := createBodyTag("掃除機")
+	tags, _ = b.GetTagSuggestions("掃除", 0)
+	assert.Equal(t, []uint{first.ID}, tagIDsOf(tags))
+
+	assert.Equal(t, nil, b.RefreshTagSuggestions())
+	tags, _ = b.GetTagSuggestions("掃除", 0)
+	assert.Equal(t, []uint{first.ID, second.ID}, tagIDsOf(tags))
+}
+
+func TestGetTagSuggestionsWithoutNewBehavior(t *testing.T) {
+	initTable()
+	b := Behavior{Store: testStore, Users: testUsers, Points: testPoints}
+	first := createBodyTag("掃除")
+	tags, err := b.GetTagSuggestions("掃除", 0)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []uint{first.ID}, tagIDsOf(tags))
+
+	// NewBehaviorを使わずに生成した場合は索引を保持せず、追加したタグもすぐに候補に含まれる。
+	second := createBodyTag("掃除機")
+	tags, _ = b.GetTagSuggestions("掃除", 0)
+	assert.Equal(t, []uint{first.ID, second.ID}, tagIDsOf(tags))
+	assert.Equal(t, nil, b.RefreshTagSuggestions())
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/SeijiOmi/posts-service/repository"
+)
+
+// ErrEmptyTagBody タグ名が空
+var ErrEmptyTagBody = errors.New("empty tag body")
+
+// ErrMergeSameTag 統合元と統合先に同じタグが指定された。
+var ErrMergeSameTag = errors.New("cannot merge tag into itself")
+
+// TagConflictError 変更後のタグ名が他のタグで使用されている場合のエラー
+type TagConflictError struct {
+	// TagID タグ名を使用しているタグ。統合する場合の統合先となる。
+	TagID uint
+	Body  string
+}
+
+func (e *TagConflictError) Error() string {
+	return "tag body " + e.Body + " is used by TagID:" + strconv.Itoa(int(e.TagID))
+}
+
+// TagInUseError 投稿情報に付いているタグを削除しようとした場合のエラー
+type TagInUseError struct {
+	TagID     uint
+	PostCount int
+}
+
+func (e *TagInUseError) Error() string {
+	return "TagID:" + strconv.Itoa(int(e.TagID)) + " is used by " + strconv.Itoa(e.PostCount) + " posts"
+}
+
+// GetTags 全てのタグを投稿情報の件数とともに取得する。
+func (b Behavior) GetTags() ([]entity.TagCount, error) {
+	return b.Store.Tags().FindAllWithCount()
+}
+
+// RenameTag タグ名を変更する。正規化したタグ名が他のタグと一致する場合はTagConflictErrorを返却する。
+func (b Behavior) RenameTag(id string, body string) (entity.Tag, error) {
+	body = b.TagNormalizer.Body(body)
+	slug := b.TagNormalizer.Slug(body)
+	if slug == "" {
+		return entity.Tag{}, ErrEmptyTagBody
+	}
+
+	var tag entity.Tag
+	err := b.Store.Transaction(func(tx repository.Store) error {
+		var err error
+		if tag, err = findTag(tx, id); err != nil {
+			return err
+		}
+
+		tag.Body = body
+		tag.Slug = slug
+		err = tx.Tags().Save(&tag)
+		if err == repository.ErrDuplicate {
+			other, findErr := tx.Tags().FindBySlug(slug)
+			if findErr != nil {
+				return findErr
+			}
+			return &TagConflictError{TagID: other.ID, Body: body}
+		}
+		return err
+	})
+
+	return tag, err
+}
+
+// MergeTag タグを統合先のタグに統合する。統合元のタグが付いた投稿情報は統合先のタグに付け替え、統合元のタグは削除する。
+func (b Behavior) MergeTag(id string, intoID uint) (entity.TagCount, error) {
+	var into entity.Tag
+	var count int
+	err := b.Store.Transaction(func(tx repository.Store) error {
+		from, err := findTag(tx, id)
+		if err != nil {
+			return err
+		}
+		if from.ID == intoID {
+			return ErrMergeSameTag
+		}
+		if into, err = tx.Tags().FindByID(intoID); err != nil {
+			return err
+		}
+
+		if err := tx.PostTags().MoveTag(from.ID, into.ID); err != nil {
+			return err
+		}
+		if err := tx.Tags().Delete(from.ID); err != nil {
+			return err
+		}
+
+		count, err = tx.Tags().CountPosts(into.ID)
+		return err
+	})
+	if err != nil {
+		return entity.TagCount{}, err
+	}
+
+	return entity.TagCount{Tag: into, PostCount: count}, nil
+}
+
+// DeleteTag 投稿情報に付いていないタグを削除する。付いている場合はTagInUseErrorを返却する。
+func (b Behavior) DeleteTag(id string) error {
+	return b.Store.Transaction(func(tx repository.Store) error {
+		tag, err := findTag(tx, id)
+		if err != nil {
+			return err
+		}
+
+		count, err := tx.Tags().CountPosts(tag.ID)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return &TagInUseError{TagID: tag.ID, PostCount: count}
+		}
+
+		return tx.Tags().Delete(tag.ID)
+	})
+}
+
+// BackfillTagSlugs slugが未設定のタグにslugを設定する。
+// 正規化したタグ名が同じタグが既にある場合は、そのタグに統合する。
+func (b Behavior) BackfillTagSlugs() error {
+	tags, err := b.Store.Tags().FindAllWithCount()
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if tag.Slug != "" {
+			continue
+		}
+		if err := b.backfillTagSlug(tag.Tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b Behavior) backfillTagSlug(tag entity.Tag) error {
+	return b.Store.Transaction(func(tx repository.Store) error {
+		slug := b.TagNormalizer.Slug(tag.Body)
+		if slug == "" {
+			return nil
+		}
+
+		same, err := tx.Tags().FindBySlug(slug)
+		if err == repository.ErrNotFound {
+			tag.Slug = slug
+			return tx.Tags().Save(&tag)
+		}
+		if err != nil || same.ID == tag.ID {
+			return err
+		}
+
+		if err := tx.PostTags().MoveTag(tag.ID, same.ID); err != nil {
+			return err
+		}
+		return tx.Tags().Delete(tag.ID)
+	})
+}
+
+func findTag(store repository.Store, id string) (entity.Tag, error) {
+	tagID, err := strconv.Atoi(id)
+	if err != nil {
+		return entity.Tag{}, err
+	}
+
+	return store.Tags().FindByID(uint(tagID))
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SeijiOmi/posts-service/entity"
+	"github.com/SeijiOmi/posts-service/repository"
+)
+
+func TestGetTags(t *testing.T) {
+	initTable()
+	used := createBodyTag("買い物")
+	unused := createBodyTag("買物")
+	post := createDefaultPost(0, 1, 0)
+	createTestPostTag(post.ID, used.ID)
+	createTestPostTag(post.ID, used.ID)
+	createTestPostTag(createDefaultPost(0, 1, 0).ID, used.ID)
+
+	b := testBehavior()
+	tags, err := b.GetTags()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []entity.TagCount{
+		{Tag: used, PostCount: 2},
+		{Tag: unused, PostCount: 0},
+	}, tags)
+}
+
+func TestRenameTag(t *testing.T) {
+	initTable()
+	tag := createBodyTag("買物")
+	other := createBodyTag("買い物")
+
+	b := testBehavior()
+	renamed, err := b.RenameTag(strconv.Itoa(int(tag.ID)), " お買物 ")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, entity.Tag{ID: tag.ID, Body: "お買物", Slug: "お買物"}, renamed)
+
+	_, err = b.RenameTag(strconv.Itoa(int(tag.ID)), "買い物")
+	assert.Equal(t, &TagConflictError{TagID: other.ID, Body: "買い物"}, err)
+
+	_, err = b.RenameTag(strconv.Itoa(int(tag.ID)), " ")
+	assert.Equal(t, ErrEmptyTagBody, err)
+
+	_, err = b.RenameTag("999", "foo")
+	assert.Equal(t, repository.ErrNotFound, err)
+}
+
+func TestMergeTag(t *testing.T) {
+	initTable()
+	from := createBodyTag("買物")
+	into := createBodyTag("買い物")
+	both := createDefaultPost(0, 1, 0)
+	createTestPostTag(both.ID, from.ID)
+	createTestPostTag(both.ID, into.ID)
+	onlyFrom := createDefaultPost(0, 1, 0)
+	createTestPostTag(onlyFrom.ID, from.ID)
+
+	b := testBehavior()
+	merged, err := b.MergeTag(strconv.Itoa(int(from.ID)), into.ID)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, entity.TagCount{Tag: into, PostCount: 2}, merged)
+
+	// 統合元のタグは削除され、両方付いていた投稿情報にも統合先のタグが1つだけ付く。
+	_, err = testStore.Tags().FindByID(from.ID)
+	assert.Equal(t, repository.ErrNotFound, err)
+	tags, _ := getTagsByPostIDs(testStore, []entity.Post{both, onlyFrom})
+	assert.Equal(t, []entity.Tag{into}, tags[both.ID])
+	assert.Equal(t, []entity.Tag{into}, tags[onlyFrom.ID])
+
+	_, err = b.MergeTag(strconv.Itoa(int(into.ID)), into.ID)
+	assert.Equal(t, ErrMergeSameTag, err)
+	_, err = b.MergeTag(strconv.Itoa(int(into.ID)), 999)
+	assert.Equal(t, repository.ErrNotFound, err)
+}
+
+func TestDeleteTag(t *testing.T) {
+	initTable()
+	used := createBodyTag("買い物")
+	unused := createBodyTag("買物")
+	createTestPostTag(createDefaultPost(0, 1, 0).ID, used.ID)
+
+	b := testBehavior()
+	err := b.DeleteTag(strconv.Itoa(int(used.ID)))
+	assert.Equal(t, &TagInUseError{TagID: used.ID, PostCount: 1}, err)
+
+	err = b.DeleteTag(strconv.Itoa(int(unused.ID)))
+	assert.Equal(t, nil, err)
+	_, err = testStore.Tags().FindByID(unused.ID)
+	assert.Equal(t, repository.ErrNotFound, err)
+}
+
+func TestDeleteTagOfCancelledPost(t *testing.T) {
+	initTable()
+	b := testBehavior()
+	created, err := b.CreateModel(ctx, entity.JoinPost{Post: postDefault, Tags: []entity.Tag{{Body: "買い物"}}}, testUser)
+	assert.Equal(t, nil, err)
+	tag := created.Tags[0]
+	assert.Equal(t, nil, b.DeleteByID(strconv.Itoa(int(created.Post.ID)), testUser))
+
+	// 取り消した投稿情報は件数に含めず、タグを削除できる。
+	tags, err := b.GetTags()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []entity.TagCount{{Tag: tag, PostCount: 0}}, tags)
+
+	assert.Equal(t, nil, b.DeleteTag(strconv.Itoa(int(tag.ID))))
+	_, err = testStore.Tags().FindByID(tag.ID)
+	assert.Equal(t, repository.ErrNotFound, err)
+}
+
+func TestCreateTagModelConcurrent(t *testing.T) {
+	initTable()
+	results := make(chan entity.Tag, 10)
+	for i := 0; i < 10; i++ {
+		go func() {
+			var tag entity.Tag
+			testStore.Transaction(func(tx repository.Store) error {
+				var err error
+				tag, err = createTagModel(tx, TagNormalizer{}, entity.Tag{Body: "同時"})
+				return err
+			})
+			results <- tag
+		}()
+	}
+
+	first := <-results
+	for i := 1; i < 10; i++ {
+		assert.Equal(t, first, <-results)
+	}
+	tags, _ := testStore.Tags().FindLikeSlug("同時")
+	assert.Equal(t, 1, len(tags))
+}
+
+func TestUpdateByIDTags(t *testing.T) {
+	initTable()
+	keep := createBodyTag("買い物")
+	remove := createBodyTag("掃除")
+	shared := createBodyTag("料理")
+	post := createDefaultPost(0, 1, 0)
+	createTestPostTag(post.ID, keep.ID)
+	createTestPostTag(post.ID, remove.ID)
+	createTestPostTag(post.ID, shared.ID)
+	createTestPostTag(createDefaultPost(0, 1, 0).ID, shared.ID)
+
+	b := testBehavior()
+	id := strconv.Itoa(int(post.ID))
+	tags := []entity.Tag{{Body: "買い物"}, {Body: "散歩"}, {Body: "散歩 "}}
+	_, err := b.UpdateByID(ctx, id, entity.PostUpdate{Tags: &tags, PruneTags: true}, testUser)
+	assert.Equal(t, nil, err)
+
+	found, _ := testStore.Tags().FindByPostID(post.ID)
+	assert.Equal(t, []string{"散歩", "買い物"}, tagBodiesOf(found))
+	// どの投稿情報にも付いていないタグのみ削除される。
+	_, err = testStore.Tags().FindByID(remove.ID)
+	assert.Equal(t, repository.ErrNotFound, err)
+	_, err = testStore.Tags().FindByID(shared.ID)
+	assert.Equal(t, nil, err)
+
+	// Tagsを指定しない場合はタグを変更しない。
+	body := "updated"
+	_, err = b.UpdateByID(ctx, id, entity.PostUpdate{Body: &body}, testUser)
+	assert.Equal(t, nil, err)
+	found, _ = testStore.Tags().FindByPostID(post.ID)
+	assert.Equal(t, 2, len(found))
+
+	// PruneTagsを指定しない場合、外したタグは残る。
+	empty := []entity.Tag{}
+	_, err = b.UpdateByID(ctx, id, entity.PostUpdate{Tags: &empty}, testUser)
+	assert.Equal(t, nil, err)
+	found, _ = testStore.Tags().FindByPostID(post.ID)
+	assert.Equal(t, 0, len(found))
+	_, err = testStore.Tags().FindByID(keep.ID)
+	assert.Equal(t, nil, err)
+}
+
+func TestUpdateByIDTagsRollback(t *testing.T) {
+	initTable()
+	tag := createBodyTag("買い物")
+	post := createDefaultPost(0, 1, 0)
+	createTestPostTag(post.ID, tag.ID)
+
+	b := testBehavior()
+	// 支払可能ポイントを超える場合は、タグの変更も反映しない。
+	point := uint(100000)
+	tags := []entity.Tag{{Body: "散歩"}}
+	_, err := b.UpdateByID(ctx, strconv.Itoa(int(post.ID)), entity.PostUpdate{Point: &point, Tags: &tags, PruneTags: true}, testUser)
+	assert.IsType(t, &InsufficientPointsError{}, err)
+
+	found, _ := testStore.Tags().FindByPostID(post.ID)
+	assert.Equal(t, []entity.Tag{tag}, found)
+	_, err = testStore.Tags().FindBySlug("散歩")
+	assert.Equal(t, repository.ErrNotFound, err)
+}
+
+func tagBodiesOf(tags []entity.Tag) []string {
+	bodies := []string{}
+	for _, tag := range tags {
+		bodies = append(bodies, tag.Body)
+	}
+	sort.Strings(bodies)
+	return bodies
+}
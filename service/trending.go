@@ -0,0 +1,129 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+const (
+	// trendingCacheTTL 集計結果を使い回す期間。トップ画面から頻繁に呼ばれるため、集計は期間ごとに1回とする。
+	trendingCacheTTL = time.Minute
+	// defaultTrendingWindow 集計期間の既定値
+	defaultTrendingWindow = "7d"
+	// defaultTrendingLimit 取得件数の既定値
+	defaultTrendingLimit = 10
+	// maxTrendingLimit 取得件数の上限
+	maxTrendingLimit = 50
+)
+
+// trendingWindows 集計期間として指定できる値
+var trendingWindows = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+// TrendingQuery 人気のタグの集計条件
+type TrendingQuery struct {
+	// Window 集計期間。24h・7d・30dのいずれか。空の場合は7d。
+	Window string
+	// OpenOnly trueの場合はヘルパー募集中の投稿情報のみ数える。
+	OpenOnly bool
+	// Limit 0の場合は既定の件数。maxTrendingLimitを超える場合はmaxTrendingLimitとする。
+	Limit int
+}
+
+// normalize 既定値を補い、キャッシュのキーとして使える形に揃える。
+func (q TrendingQuery) normalize() (TrendingQuery, error) {
+	if q.Window == "" {
+		q.Window = defaultTrendingWindow
+	}
+	if _, ok := trendingWindows[q.Window]; !ok {
+		return q, &InvalidFilterError{Param: "window", Value: q.Window}
+	}
+
+	switch {
+	case q.Limit <= 0:
+		q.Limit = defaultTrendingLimit
+	case q.Limit > maxTrendingLimit:
+		q.Limit = maxTrendingLimit
+	}
+	return q, nil
+}
+
+// trendingCache 集計条件ごとの人気のタグの集計結果。
+// 集計条件は組み合わせが限られるため、件数の上限は設けない。
+// nilの場合(NewBehaviorを使わずに生成したBehavior)はキャッシュせず、毎回集計する。
+type trendingCache struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	entries map[TrendingQuery]trendingEntry
+}
+
+type trendingEntry struct {
+	tags    []entity.TagCount
+	expires time.Time
+}
+
+func newTrendingCache() *trendingCache {
+	return &trendingCache{now: time.Now, entries: map[TrendingQuery]trendingEntry{}}
+}
+
+func (c *trendingCache) clock() time.Time {
+	if c == nil {
+		return time.Now()
+	}
+	return c.now()
+}
+
+func (c *trendingCache) get(query TrendingQuery) ([]entity.TagCount, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[query]
+	if !ok || !c.now().Before(entry.expires) {
+		return nil, false
+	}
+	return entry.tags, true
+}
+
+func (c *trendingCache) set(query TrendingQuery, tags []entity.TagCount) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[query] = trendingEntry{tags: tags, expires: c.now().Add(trendingCacheTTL)}
+}
+
+// GetTrendingTags 集計期間内に作成された投稿情報に多く付いたタグを取得する。
+// 集計結果はtrendingCacheTTLの間キャッシュする。
+func (b Behavior) GetTrendingTags(query TrendingQuery) ([]entity.TagCount, error) {
+	query, err := query.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	if tags, ok := b.trending.get(query); ok {
+		return tags, nil
+	}
+
+	var statuses []entity.Status
+	if query.OpenOnly {
+		statuses = []entity.Status{entity.Open}
+	}
+	since := b.trending.clock().Add(-trendingWindows[query.Window])
+	tags, err := b.Store.Tags().FindTrending(since, statuses, query.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	b.trending.set(query, tags)
+	return tags, nil
+}
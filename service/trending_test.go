@@ -0,0 +1,95 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SeijiOmi/posts-service/entity"
+)
+
+func createAgedPost(age time.Duration, status entity.Status, tags ...entity.Tag) entity.Post {
+	post := postDefault
+	post.UserID = 1
+	post.Status = status
+	post.CreatedAt = time.Now().Add(-age)
+	testStore.Posts().Create(&post)
+	for _, tag := range tags {
+		createTestPostTag(post.ID, tag.ID)
+	}
+	return post
+}
+
+func TestGetTrendingTags(t *testing.T) {
+	initTable()
+	shopping := createBodyTag("買い物")
+	cleaning := createBodyTag("掃除")
+	walking := createBodyTag("散歩")
+	day := 24 * time.Hour
+
+	createAgedPost(time.Hour, entity.Open, shopping, cleaning)
+	createAgedPost(2*time.Hour, entity.Matched, cleaning)
+	createAgedPost(2*day, entity.Open, shopping, walking)
+	createAgedPost(3*day, entity.Open, walking)
+	createAgedPost(20*day, entity.Open, walking)
+	createAgedPost(40*day, entity.Open, shopping)
+
+	cases := []struct {
+		query TrendingQuery
+		tags  []entity.TagCount
+	}{
+		{TrendingQuery{Window: "24h"}, []entity.TagCount{{Tag: cleaning, PostCount: 2}, {Tag: shopping, PostCount: 1}}},
+		{TrendingQuery{Window: "24h", OpenOnly: true}, []entity.TagCount{{Tag: shopping, PostCount: 1}, {Tag: cleaning, PostCount: 1}}},
+		{TrendingQuery{}, []entity.TagCount{{Tag: shopping, PostCount: 2}, {Tag: cleaning, PostCount: 2}, {Tag: walking, PostCount: 2}}},
+		{TrendingQuery{Window: "30d", Limit: 1}, []entity.TagCount{{Tag: walking, PostCount: 3}}},
+	}
+
+	b := testBehavior()
+	for _, c := range cases {
+		tags, err := b.GetTrendingTags(c.query)
+		assert.Equal(t, nil, err, c.query)
+		assert.Equal(t, c.tags, tags, c.query)
+	}
+
+	_, err := b.GetTrendingTags(TrendingQuery{Window: "1y"})
+	assert.Equal(t, &InvalidFilterError{Param: "window", Value: "1y"}, err)
+}
+
+func TestGetTrendingTagsCache(t *testing.T) {
+	initTable()
+	tag := createBodyTag("買い物")
+	createAgedPost(time.Hour, entity.Open, tag)
+
+	b := testBehavior()
+	now := time.Now()
+	b.trending.now = func() time.Time { return now }
+
+	tags, _ := b.GetTrendingTags(TrendingQuery{})
+	assert.Equal(t, 1, tags[0].PostCount)
+
+	// 既定値を補った条件が同じ場合は、キャッシュ期間中は集計し直さない。
+	createAgedPost(time.Hour, entity.Open, tag)
+	tags, _ = b.GetTrendingTags(TrendingQuery{Window: "7d", Limit: defaultTrendingLimit})
+	assert.Equal(t, 1, tags[0].PostCount)
+
+	now = now.Add(trendingCacheTTL)
+	tags, _ = b.GetTrendingTags(TrendingQuery{})
+	assert.Equal(t, 2, tags[0].PostCount)
+}
+
+func TestGetTrendingTagsWithoutNewBehavior(t *testing.T) {
+	initTable()
+	walking := createBodyTag("散歩")
+	createAgedPost(time.Hour, entity.Open, walking)
+
+	// NewBehaviorを使わずに生成した場合はキャッシュせずに集計する。
+	b := Behavior{Store: testStore, Users: testUsers, Points: testPoints}
+	tags, err := b.GetTrendingTags(TrendingQuery{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []entity.TagCount{{Tag: walking, PostCount: 1}}, tags)
+
+	createAgedPost(time.Hour, entity.Open, walking)
+	tags, _ = b.GetTrendingTags(TrendingQuery{})
+	assert.Equal(t, 2, tags[0].PostCount)
+}